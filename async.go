@@ -0,0 +1,213 @@
+package hook
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+)
+
+// OverflowPolicy determines what happens when an event is added to a full
+// AsyncQueue.
+type OverflowPolicy int
+
+const (
+	// Block blocks the operation until there is space in the queue.
+	Block OverflowPolicy = iota
+	// DropOldest drops the oldest queued event to make space for the new one.
+	DropOldest
+	// DropNewest drops the new event.
+	DropNewest
+)
+
+// AsyncEvent is a completed operation, it's arguments and results.
+type AsyncEvent struct {
+	Op     call.Op
+	Result call.Result
+}
+
+// AsyncFunc is a handler for completed operations that is called
+// asynchronously by the workers of an AsyncQueue.
+// Byte slices in the event must not be modified.
+type AsyncFunc func(AsyncEvent)
+
+// AsyncQueue is a bounded queue of completed operations that are passed to an
+// AsyncFunc by a pool of workers, so that expensive after hooks do not slow
+// down the operations they are called for.
+type AsyncQueue struct {
+	f        AsyncFunc
+	size     int
+	overflow OverflowPolicy
+	onPanic  PanicFunc
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	events  []AsyncEvent
+	busy    int
+	dropped uint64
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewAsyncQueue creates a queue of up to `size` events that are passed to `f`
+// by `workers` goroutines. `overflow` determines what happens when an event is
+// added to the full queue. Panics in `f` are recovered so that the worker
+// keeps running and, if not nil, `onPanic` is called for each of them.
+func NewAsyncQueue(f AsyncFunc, size, workers int, overflow OverflowPolicy, onPanic PanicFunc) (*AsyncQueue, error) {
+	if f == nil {
+		return nil, fmt.Errorf("nil async hook")
+	}
+	if size < 1 {
+		return nil, fmt.Errorf("invalid async queue size %d", size)
+	}
+	if workers < 1 {
+		return nil, fmt.Errorf("invalid async queue workers %d", workers)
+	}
+	if overflow < Block || overflow > DropNewest {
+		return nil, fmt.Errorf("invalid async queue overflow policy %d", overflow)
+	}
+	q := &AsyncQueue{f: f, size: size, overflow: overflow, onPanic: onPanic}
+	q.cond = sync.NewCond(&q.mu)
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q, nil
+}
+
+// Depth returns the number of events waiting in the queue.
+func (q *AsyncQueue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events)
+}
+
+// Dropped returns the number of events that have been dropped because the
+// queue was full or closed.
+func (q *AsyncQueue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Add adds an event to the queue, applying the overflow policy if it is full.
+// Events added after the queue is closed are dropped.
+func (q *AsyncQueue) Add(e AsyncEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && len(q.events) >= q.size {
+		switch q.overflow {
+		case DropOldest:
+			q.events = q.events[1:]
+			q.dropped++
+		case DropNewest:
+			q.dropped++
+			return
+		default:
+			q.cond.Wait()
+		}
+	}
+	if q.closed {
+		q.dropped++
+		return
+	}
+	q.events = append(q.events, e)
+	q.cond.Broadcast()
+}
+
+// Drain waits until all queued events have been handled.
+func (q *AsyncQueue) Drain() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.events) > 0 || q.busy > 0 {
+		q.cond.Wait()
+	}
+}
+
+// Close handles the queued events and stops the workers.
+func (q *AsyncQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+func (q *AsyncQueue) work() {
+	defer q.wg.Done()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		for len(q.events) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.events) == 0 {
+			return
+		}
+		e := q.events[0]
+		q.events = q.events[1:]
+		q.busy++
+		q.cond.Broadcast()
+
+		q.mu.Unlock()
+		q.handle(e)
+		q.mu.Lock()
+
+		q.busy--
+		q.cond.Broadcast()
+	}
+}
+
+// handle passes an event to the AsyncFunc, recovering if it panics.
+func (q *AsyncQueue) handle(e AsyncEvent) {
+	defer func() {
+		v := recover()
+		if v == nil || q.onPanic == nil {
+			return
+		}
+		perr := &call.PanicError{
+			Hook:  "Async",
+			Func:  runtime.FuncForPC(reflect.ValueOf(q.f).Pointer()).Name(),
+			Value: v,
+			Stack: debug.Stack(),
+		}
+		if e.Op.Call != nil {
+			perr.Op = e.Op.Call.Op()
+		}
+		q.onPanic(perr)
+	}()
+	q.f(e)
+}
+
+// WithAsyncAfter configures every completed operation of the datastore, and of
+// the batches, transactions and query results it creates, to be added to the
+// queue `q`. Close drains the queue before closing the wrapped datastore and
+// closes the queue once the wrapped datastore has been closed successfully.
+//
+// Using the Block overflow policy, the AsyncFunc of the queue must not call
+// the datastore or it may deadlock.
+func WithAsyncAfter(q *AsyncQueue) Option {
+	return func(o *Options) error {
+		if q == nil {
+			return fmt.Errorf("nil async queue")
+		}
+		o.Interceptors = append(o.Interceptors, func(op call.Op, next call.Handler) call.Result {
+			if op.Call.Op() != "Datastore.Close" {
+				res := next(op)
+				q.Add(AsyncEvent{Op: op, Result: res})
+				return res
+			}
+			q.Drain()
+			res := next(op)
+			q.Add(AsyncEvent{Op: op, Result: res})
+			if res.Err == nil {
+				q.Close()
+			}
+			return res
+		})
+		return nil
+	}
+}
@@ -0,0 +1,220 @@
+package hook
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/ipfs/go-datastore"
+)
+
+func TestAsyncAfter(t *testing.T) {
+	var mu sync.Mutex
+	var ops []string
+
+	onEvent := func(e AsyncEvent) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		ops = append(ops, e.Op.Call.Op())
+	}
+
+	q, err := NewAsyncQueue(onEvent, 100, 2, Block, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, WithAsyncAfter(q))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		err = hds.Put(datastore.NewKey("test"), []byte("test"))
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+
+	err = hds.Close()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(ops) != 11 {
+		t.Fatal("expected all events to be handled", ops)
+	}
+	if ops[10] != "Datastore.Close" {
+		t.Fatal("expected close to be handled last", ops)
+	}
+	if q.Depth() != 0 || q.Dropped() != 0 {
+		t.Fatal("unexpected queue stats", q.Depth(), q.Dropped())
+	}
+}
+
+func TestAsyncAfterOverflow(t *testing.T) {
+	policies := []OverflowPolicy{DropNewest, DropOldest}
+
+	for _, policy := range policies {
+		var mu sync.Mutex
+		var keys []string
+		started := make(chan struct{}, 10)
+		release := make(chan struct{})
+
+		onEvent := func(e AsyncEvent) {
+			started <- struct{}{}
+			<-release
+			mu.Lock()
+			defer mu.Unlock()
+			keys = append(keys, e.Op.Key.String())
+		}
+
+		q, err := NewAsyncQueue(onEvent, 1, 1, policy, nil)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		hds, err := NewDatastore(datastore.NewMapDatastore(), WithAsyncAfter(q))
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		hds.Put(datastore.NewKey("1"), []byte("test"))
+		<-started
+		hds.Put(datastore.NewKey("2"), []byte("test"))
+		hds.Put(datastore.NewKey("3"), []byte("test"))
+
+		if q.Depth() != 1 || q.Dropped() != 1 {
+			t.Fatal("unexpected queue stats", q.Depth(), q.Dropped())
+		}
+
+		close(release)
+		q.Drain()
+
+		mu.Lock()
+		expected := "/2"
+		if policy == DropOldest {
+			expected = "/3"
+		}
+		if len(keys) != 2 || keys[0] != "/1" || keys[1] != expected {
+			t.Fatal("incorrect handled events", keys)
+		}
+		mu.Unlock()
+
+		hds.Close()
+	}
+}
+
+func TestAsyncAfterCloseError(t *testing.T) {
+	q, err := NewAsyncQueue(func(AsyncEvent) {}, 10, 1, Block, nil)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	errVeto := errors.New("veto")
+	veto := true
+	hds, err := NewDatastore(
+		datastore.NewMapDatastore(),
+		WithAsyncAfter(q),
+		WithBeforeClose(func(c *call.Call) error {
+			if veto {
+				return errVeto
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = hds.Close()
+	if !errors.Is(err, errVeto) {
+		t.Fatal("expected close error", err)
+	}
+
+	hds.Put(datastore.NewKey("test"), []byte("test"))
+	q.Drain()
+	if q.Dropped() != 0 {
+		t.Fatal("expected events not to be dropped after failed close", q.Dropped())
+	}
+
+	veto = false
+	err = hds.Close()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	hds.Put(datastore.NewKey("test"), []byte("test"))
+	if q.Dropped() != 1 {
+		t.Fatal("expected events to be dropped after close", q.Dropped())
+	}
+}
+
+func TestNewAsyncQueueInvalid(t *testing.T) {
+	_, err := NewAsyncQueue(func(AsyncEvent) {}, 0, 1, Block, nil)
+	if err == nil {
+		t.Fatal("expected invalid size error")
+	}
+
+	_, err = NewAsyncQueue(func(AsyncEvent) {}, 1, 1, OverflowPolicy(10), nil)
+	if err == nil {
+		t.Fatal("expected invalid overflow policy error")
+	}
+}
+
+func TestAsyncAfterPanic(t *testing.T) {
+	var mu sync.Mutex
+	var perrs []*call.PanicError
+	var keys []string
+
+	onEvent := func(e AsyncEvent) {
+		if e.Op.Key.String() == "/panic" {
+			panic("boom")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, e.Op.Key.String())
+	}
+	onPanic := func(perr *call.PanicError) {
+		mu.Lock()
+		defer mu.Unlock()
+		perrs = append(perrs, perr)
+	}
+
+	q, err := NewAsyncQueue(onEvent, 10, 1, Block, onPanic)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hds, err := NewDatastore(datastore.NewMapDatastore(), WithAsyncAfter(q))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for _, k := range []string{"/panic", "/test"} {
+		err = hds.Put(datastore.NewKey(k), []byte("test"))
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+	q.Drain()
+
+	mu.Lock()
+	if len(perrs) != 1 || perrs[0].Op != "Datastore.Put" || perrs[0].Hook != "Async" || perrs[0].Value != "boom" {
+		t.Fatal("expected panic to be reported", perrs)
+	}
+	if len(keys) != 1 || keys[0] != "/test" {
+		t.Fatal("expected worker to keep running after panic", keys)
+	}
+	mu.Unlock()
+
+	err = hds.Close()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+}
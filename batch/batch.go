@@ -1,54 +1,174 @@
 package batch
 
 import (
+	"sync"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/internal/hookerr"
 	"github.com/ipfs/go-datastore"
 )
 
 // Batch is a group of Puts and Deletes to be performed (Committed) in one shot.
+// If BeforeCommit hooks are configured, the Puts and Deletes are recorded and
+// passed to the wrapped batch when the batch is committed, so that the hooks
+// can inspect or rewrite them. Otherwise they are passed to the wrapped batch
+// straight away and only recorded if AfterCommit hooks are configured.
 type Batch struct {
 	bch     datastore.Batch
 	options Options
+
+	mu      sync.Mutex
+	pending []Op
+}
+
+// Op is a pending Put or Delete in a batch.
+type Op struct {
+	Delete bool
+	Key    datastore.Key
+	Value  []byte
 }
 
 // NewBatch wraps a datastore.Batch and adds optional before and after hooks into it's methods.
-func NewBatch(bch datastore.Batch, options ...Option) *Batch {
+// It returns an error if any of the options fail or are invalid.
+func NewBatch(bch datastore.Batch, options ...Option) (*Batch, error) {
 	opts := Options{}
-	opts.Apply(options...)
-	return &Batch{bch: bch, options: opts}
+	if err := opts.Apply(options...); err != nil {
+		return nil, err
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	opts.recoverPanics()
+	return &Batch{bch: bch, options: opts}, nil
 }
 
-// Put stores the object `value` named by `key`, it calls OnBeforePut and OnAfterPut hooks.
+// Put adds storing the object `value` named by `key` to the batch, it calls OnBeforePut and OnAfterPut hooks.
 func (hbh *Batch) Put(key datastore.Key, value []byte) error {
-	if hbh.options.BeforePut != nil {
-		key, value = hbh.options.BeforePut(key, value)
-	}
-	err := hbh.bch.Put(key, value)
-	if hbh.options.AfterPut != nil {
-		err = hbh.options.AfterPut(key, value, err)
-	}
-	return err
+	op := call.Op{Call: call.New("Batch.Put"), Key: key, Value: value}
+	result := call.Invoke(hbh.options.Interceptors, op, func(op call.Op) call.Result {
+		c, key, value := op.Call, op.Key, op.Value
+		var err error
+		for _, f := range hbh.options.BeforePut {
+			if key, value, err = f(c, key, value); err != nil {
+				err = hookerr.Wrap(c, "BeforePut", f, op.Key, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			err = hbh.add(Op{Key: key, Value: value})
+		}
+		for _, f := range hbh.options.AfterPut {
+			prev := err
+			err = f(c, key, value, prev)
+			err = hookerr.Wrap(c, "AfterPut", f, op.Key, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
 }
 
-// Delete removes the value for given `key`, it calls OnBeforeDelete and OnAfterDelete hooks.
+// Delete adds removing the value for given `key` to the batch, it calls OnBeforeDelete and OnAfterDelete hooks.
 func (hbh *Batch) Delete(key datastore.Key) error {
-	if hbh.options.BeforeDelete != nil {
-		key = hbh.options.BeforeDelete(key)
-	}
-	err := hbh.bch.Delete(key)
-	if hbh.options.AfterDelete != nil {
-		err = hbh.options.AfterDelete(key, err)
-	}
-	return err
+	op := call.Op{Call: call.New("Batch.Delete"), Key: key}
+	result := call.Invoke(hbh.options.Interceptors, op, func(op call.Op) call.Result {
+		c, key := op.Call, op.Key
+		var err error
+		for _, f := range hbh.options.BeforeDelete {
+			if key, err = f(c, key); err != nil {
+				err = hookerr.Wrap(c, "BeforeDelete", f, op.Key, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			err = hbh.add(Op{Delete: true, Key: key})
+		}
+		for _, f := range hbh.options.AfterDelete {
+			prev := err
+			err = f(c, key, prev)
+			err = hookerr.Wrap(c, "AfterDelete", f, op.Key, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
 }
 
 // Commit submits the batch to the datastore for processing, it calls OnBeforeCommit and OnAfterCommit hooks.
+// The hooks are passed the pending Puts and Deletes in the order they were added.
 func (hbh *Batch) Commit() error {
-	if hbh.options.BeforeCommit != nil {
-		hbh.options.BeforeCommit()
+	op := call.Op{Call: call.New("Batch.Commit")}
+	result := call.Invoke(hbh.options.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		hbh.mu.Lock()
+		n := len(hbh.pending)
+		ops := hbh.pending[:n:n]
+		hbh.mu.Unlock()
+		var err error
+		for _, f := range hbh.options.BeforeCommit {
+			if ops, err = f(c, ops); err != nil {
+				err = hookerr.Wrap(c, "BeforeCommit", f, datastore.Key{}, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			err = hbh.commit(ops, n)
+		}
+		for _, f := range hbh.options.AfterCommit {
+			prev := err
+			err = f(c, ops, prev)
+			err = hookerr.Wrap(c, "AfterCommit", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
+}
+
+// deferred returns true if Puts and Deletes are only passed to the wrapped
+// batch when the batch is committed.
+func (hbh *Batch) deferred() bool {
+	return len(hbh.options.BeforeCommit) > 0
+}
+
+// add passes a Put or Delete to the wrapped batch, unless it is deferred, and
+// records it for the commit hooks.
+func (hbh *Batch) add(op Op) error {
+	if !hbh.deferred() {
+		var err error
+		if op.Delete {
+			err = hbh.bch.Delete(op.Key)
+		} else {
+			err = hbh.bch.Put(op.Key, op.Value)
+		}
+		if err != nil || len(hbh.options.AfterCommit) == 0 {
+			return err
+		}
+	}
+	hbh.mu.Lock()
+	defer hbh.mu.Unlock()
+	hbh.pending = append(hbh.pending, op)
+	return nil
+}
+
+// commit passes the ops to the wrapped batch, if they were deferred, and
+// commits it. The first `n` pending ops, those the ops were derived from, are
+// cleared, as the wrapped batch is no longer usable if it fails. Ops added
+// since are left pending.
+func (hbh *Batch) commit(ops []Op, n int) error {
+	hbh.mu.Lock()
+	hbh.pending = hbh.pending[n:]
+	hbh.mu.Unlock()
+	if !hbh.deferred() {
+		return hbh.bch.Commit()
 	}
-	err := hbh.bch.Commit()
-	if hbh.options.AfterCommit != nil {
-		err = hbh.options.AfterCommit(err)
+	for _, op := range ops {
+		var err error
+		if op.Delete {
+			err = hbh.bch.Delete(op.Key)
+		} else {
+			err = hbh.bch.Put(op.Key, op.Value)
+		}
+		if err != nil {
+			return err
+		}
 	}
-	return err
+	return hbh.bch.Commit()
 }
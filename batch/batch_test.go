@@ -2,8 +2,11 @@ package batch
 
 import (
 	"bytes"
+	"errors"
+	"sync"
 	"testing"
 
+	"github.com/alanshaw/ipfs-hookds/call"
 	"github.com/ipfs/go-datastore"
 )
 
@@ -16,8 +19,13 @@ func TestIsBatch(t *testing.T) {
 		t.Fatal("unexpected error", err)
 	}
 
+	hbh, err := NewBatch(bch)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
 	// ensure it implements datastore.Batch
-	var bds datastore.Batch = NewBatch(bch)
+	var bds datastore.Batch = hbh
 
 	err = bds.Put(datastore.NewKey("test"), []byte("test"))
 	if err != nil {
@@ -37,7 +45,7 @@ func TestBatchHookPut(t *testing.T) {
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
-	onBeforePut := func(k datastore.Key, v []byte) (datastore.Key, []byte) {
+	onBeforePut := func(c *call.Call, k datastore.Key, v []byte) (datastore.Key, []byte, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
@@ -45,10 +53,10 @@ func TestBatchHookPut(t *testing.T) {
 			t.Fatal("incorrect value")
 		}
 		beforeHookCalled = true
-		return k, v
+		return k, v, nil
 	}
 
-	onAfterPut := func(k datastore.Key, v []byte, err error) error {
+	onAfterPut := func(c *call.Call, k datastore.Key, v []byte, err error) error {
 		afterHookCalled = true
 		return err
 	}
@@ -61,7 +69,10 @@ func TestBatchHookPut(t *testing.T) {
 		t.Fatal("unexpected error", err)
 	}
 
-	hbh := NewBatch(bch, WithBeforePut(onBeforePut), WithAfterPut(onAfterPut))
+	hbh, err := NewBatch(bch, WithBeforePut(onBeforePut), WithAfterPut(onAfterPut))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 
 	err = hbh.Put(key, value)
 	if err != nil {
@@ -89,15 +100,15 @@ func TestBatchHookDelete(t *testing.T) {
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
-	onBeforeDelete := func(k datastore.Key) datastore.Key {
+	onBeforeDelete := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
 		beforeHookCalled = true
-		return k
+		return k, nil
 	}
 
-	onAfterDelete := func(k datastore.Key, err error) error {
+	onAfterDelete := func(c *call.Call, k datastore.Key, err error) error {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
@@ -118,7 +129,10 @@ func TestBatchHookDelete(t *testing.T) {
 		t.Fatal("unexpected error", err)
 	}
 
-	hbh := NewBatch(bch, WithBeforeDelete(onBeforeDelete), WithAfterDelete(onAfterDelete))
+	hbh, err := NewBatch(bch, WithBeforeDelete(onBeforeDelete), WithAfterDelete(onAfterDelete))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 
 	err = hbh.Delete(key)
 	if err != nil {
@@ -146,11 +160,18 @@ func TestBatchHookCommit(t *testing.T) {
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
-	onBeforeCommit := func() {
+	onBeforeCommit := func(c *call.Call, ops []Op) ([]Op, error) {
+		if len(ops) != 1 || ops[0].Delete || ops[0].Key != key || !bytes.Equal(ops[0].Value, value) {
+			t.Fatal("incorrect pending ops", ops)
+		}
 		beforeHookCalled = true
+		return ops, nil
 	}
 
-	onAfterCommit := func(err error) error {
+	onAfterCommit := func(c *call.Call, ops []Op, err error) error {
+		if len(ops) != 1 {
+			t.Fatal("incorrect committed ops", ops)
+		}
 		afterHookCalled = true
 		return err
 	}
@@ -163,7 +184,10 @@ func TestBatchHookCommit(t *testing.T) {
 		t.Fatal("unexpected error", err)
 	}
 
-	hbh := NewBatch(bch, WithBeforeCommit(onBeforeCommit), WithAfterCommit(onAfterCommit))
+	hbh, err := NewBatch(bch, WithBeforeCommit(onBeforeCommit), WithAfterCommit(onAfterCommit))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 
 	err = hbh.Put(key, value)
 	if err != nil {
@@ -183,3 +207,287 @@ func TestBatchHookCommit(t *testing.T) {
 		t.Fatal("after hook not called")
 	}
 }
+
+func TestBatchHookCommitMultiple(t *testing.T) {
+	var calls []string
+
+	onAfterCommit0 := func(c *call.Call, ops []Op, err error) error {
+		calls = append(calls, "after0")
+		return err
+	}
+
+	onAfterCommit1 := func(c *call.Call, ops []Op, err error) error {
+		calls = append(calls, "after1")
+		return err
+	}
+
+	ds := datastore.NewMapDatastore()
+	defer ds.Close()
+
+	bch, err := ds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hbh, err := NewBatch(bch, WithAfterCommit(onAfterCommit0), WithAfterCommit(onAfterCommit1))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = hbh.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(calls) != 2 || calls[0] != "after0" || calls[1] != "after1" {
+		t.Fatal("incorrect hook call order", calls)
+	}
+}
+
+func TestBatchHookCommitBeforeError(t *testing.T) {
+	afterHookCalled := false
+
+	key := datastore.NewKey("test")
+	value := []byte("test")
+	rejected := errors.New("rejected")
+
+	onBeforeCommit := func(c *call.Call, ops []Op) ([]Op, error) {
+		return ops, rejected
+	}
+
+	onAfterCommit := func(c *call.Call, ops []Op, err error) error {
+		if !errors.Is(err, rejected) {
+			t.Fatal("expected before hook error", err)
+		}
+		afterHookCalled = true
+		return err
+	}
+
+	ds := datastore.NewMapDatastore()
+	defer ds.Close()
+
+	bch, err := ds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hbh, err := NewBatch(bch, WithBeforeCommit(onBeforeCommit), WithAfterCommit(onAfterCommit))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = hbh.Put(key, value)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = hbh.Commit()
+	if !errors.Is(err, rejected) {
+		t.Fatal("expected before hook error", err)
+	}
+
+	var herr *call.HookError
+	if !errors.As(err, &herr) || herr.Op != "Batch.Commit" || herr.Hook != "BeforeCommit" {
+		t.Fatal("expected hook error", err)
+	}
+
+	exists, err := ds.Has(key)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if exists {
+		t.Fatal("expected batch not to be committed")
+	}
+
+	if !afterHookCalled {
+		t.Fatal("after hook not called")
+	}
+}
+
+func TestBatchHookCommitRewrite(t *testing.T) {
+	onBeforeCommit := func(c *call.Call, ops []Op) ([]Op, error) {
+		var rewritten []Op
+		for _, op := range ops {
+			if op.Key.String() == "/skip" {
+				continue
+			}
+			rewritten = append(rewritten, op)
+		}
+		return append(rewritten, Op{Key: datastore.NewKey("extra"), Value: []byte("extra")}), nil
+	}
+
+	ds := datastore.NewMapDatastore()
+	defer ds.Close()
+
+	bch, err := ds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hbh, err := NewBatch(bch, WithBeforeCommit(onBeforeCommit))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = hbh.Put(datastore.NewKey("keep"), []byte("keep"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = hbh.Put(datastore.NewKey("skip"), []byte("skip"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	exists, err := ds.Has(datastore.NewKey("keep"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if exists {
+		t.Fatal("expected put to be pending")
+	}
+
+	err = hbh.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for _, k := range []string{"keep", "extra"} {
+		exists, err := ds.Has(datastore.NewKey(k))
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if !exists {
+			t.Fatal("expected key to be committed", k)
+		}
+	}
+
+	exists, err = ds.Has(datastore.NewKey("skip"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if exists {
+		t.Fatal("expected key to be removed from batch")
+	}
+}
+
+func TestBatchHookCommitConcurrentPut(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var once sync.Once
+	onBeforeCommit := func(c *call.Call, ops []Op) ([]Op, error) {
+		// only the first commit is slow
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		return ops, nil
+	}
+
+	ds := datastore.NewMapDatastore()
+	defer ds.Close()
+
+	bch, err := ds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hbh, err := NewBatch(bch, WithBeforeCommit(onBeforeCommit))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = hbh.Put(datastore.NewKey("first"), []byte("first"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	errs := make(chan error)
+	go func() { errs <- hbh.Commit() }()
+
+	<-started
+	err = hbh.Put(datastore.NewKey("late"), []byte("late"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	close(release)
+
+	err = <-errs
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if has, _ := ds.Has(datastore.NewKey("late")); has {
+		t.Fatal("expected late put not to be committed")
+	}
+
+	err = hbh.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if has, _ := ds.Has(datastore.NewKey("late")); !has {
+		t.Fatal("expected late put to be committed by the next commit")
+	}
+}
+
+// failingBatch is a batch that fails to Put.
+type failingBatch struct {
+	datastore.Batch
+	puts int
+}
+
+var errPut = errors.New("put failed")
+
+func (b *failingBatch) Put(key datastore.Key, value []byte) error {
+	b.puts++
+	return errPut
+}
+
+func TestBatchHookPutNotDeferred(t *testing.T) {
+	var afterPutErr error
+	onAfterPut := func(c *call.Call, k datastore.Key, v []byte, err error) error {
+		afterPutErr = err
+		return err
+	}
+
+	var committed []Op
+	onAfterCommit := func(c *call.Call, ops []Op, err error) error {
+		committed = ops
+		return err
+	}
+
+	ds := datastore.NewMapDatastore()
+	defer ds.Close()
+
+	bch, err := ds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	// without before commit hooks writes are passed to the wrapped batch straight away
+	fbh := &failingBatch{Batch: bch}
+	hbh, err := NewBatch(fbh, WithAfterPut(onAfterPut), WithAfterCommit(onAfterCommit))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = hbh.Put(datastore.NewKey("test"), []byte("test"))
+	if err != errPut || afterPutErr != errPut || fbh.puts != 1 {
+		t.Fatal("expected put error to be passed to after hook", err, afterPutErr, fbh.puts)
+	}
+
+	err = hbh.Delete(datastore.NewKey("test"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = hbh.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(committed) != 1 || !committed[0].Delete {
+		t.Fatal("incorrect committed ops", committed)
+	}
+}
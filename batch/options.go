@@ -3,35 +3,59 @@ package batch
 import (
 	"fmt"
 
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/internal/recovery"
+	"github.com/alanshaw/ipfs-hookds/internal/validate"
 	"github.com/ipfs/go-datastore"
 )
 
 // BeforePutFunc is a handler for the before Put hook
-type BeforePutFunc func(datastore.Key, []byte) (datastore.Key, []byte)
+// Returning an error aborts the Put and the error is passed to the after hooks.
+type BeforePutFunc func(*call.Call, datastore.Key, []byte) (datastore.Key, []byte, error)
 
 // AfterPutFunc is a handler for the after Put hook
-type AfterPutFunc func(datastore.Key, []byte, error) error
+// If BeforeCommit hooks are configured, Puts are only passed to the wrapped
+// batch when the batch is committed, so the error is only non-nil if a before
+// hook failed and errors of the wrapped batch are returned by Commit.
+type AfterPutFunc func(*call.Call, datastore.Key, []byte, error) error
 
 // BeforeDeleteFunc is a handler for the before Delete hook
-type BeforeDeleteFunc func(datastore.Key) datastore.Key
+// Returning an error aborts the Delete and the error is passed to the after hooks.
+type BeforeDeleteFunc func(*call.Call, datastore.Key) (datastore.Key, error)
 
 // AfterDeleteFunc is a handler for the after Delete hook
-type AfterDeleteFunc func(datastore.Key, error) error
+// If BeforeCommit hooks are configured, Deletes are only passed to the wrapped
+// batch when the batch is committed, so the error is only non-nil if a before
+// hook failed and errors of the wrapped batch are returned by Commit.
+type AfterDeleteFunc func(*call.Call, datastore.Key, error) error
 
-// BeforeCommitFunc is a handler for the before Commit hook
-type BeforeCommitFunc func()
+// BeforeCommitFunc is a handler for the before Commit hook, it is passed the
+// pending Puts and Deletes of the batch and returns the ones to be committed.
+// Returning an error aborts the Commit and the error is passed to the after hooks.
+type BeforeCommitFunc func(*call.Call, []Op) ([]Op, error)
 
-// AfterCommitFunc is a handler for the after Commit hook
-type AfterCommitFunc func(error) error
+// AfterCommitFunc is a handler for the after Commit hook, it is passed the
+// Puts and Deletes that were committed.
+type AfterCommitFunc func(*call.Call, []Op, error) error
 
-// Options are batch options.
+// ValidateFunc validates options once all options have been applied.
+type ValidateFunc func(*Options) error
+
+// Options are batch options. Hooks configured for the same method are called
+// in order, each receiving the output of the previous hook.
 type Options struct {
-	BeforePut    BeforePutFunc
-	AfterPut     AfterPutFunc
-	BeforeDelete BeforeDeleteFunc
-	AfterDelete  AfterDeleteFunc
-	BeforeCommit BeforeCommitFunc
-	AfterCommit  AfterCommitFunc
+	BeforePut    []BeforePutFunc
+	AfterPut     []AfterPutFunc
+	BeforeDelete []BeforeDeleteFunc
+	AfterDelete  []AfterDeleteFunc
+	BeforeCommit []BeforeCommitFunc
+	AfterCommit  []AfterCommitFunc
+
+	Interceptors []call.Interceptor
+
+	validators    []validate.Func
+	panicRecovery bool
+	onPanic       []func(*call.PanicError)
 }
 
 // Option is the batch option type.
@@ -47,56 +71,141 @@ func (o *Options) Apply(opts ...Option) error {
 	return nil
 }
 
+// validate checks that no hooks are nil and calls the configured validators.
+func (o *Options) validate() error {
+	return validate.Check("batch options", o, o.validators)
+}
+
+// Validate applies the options and validates them without creating a batch,
+// e.g. to check options that are applied to later batches.
+func Validate(options ...Option) error {
+	opts := Options{}
+	if err := opts.Apply(options...); err != nil {
+		return err
+	}
+	return opts.validate()
+}
+
+// recoverPanics replaces the hooks and interceptors with ones that recover
+// from panics, if configured WithPanicRecovery.
+func (o *Options) recoverPanics() {
+	if !o.panicRecovery {
+		return
+	}
+	onPanic := func(perr *call.PanicError) {
+		for _, f := range o.onPanic {
+			f(perr)
+		}
+	}
+	recovery.Hooks(o, onPanic, "Interceptors")
+	o.Interceptors = recovery.Interceptors(o.Interceptors, onPanic)
+}
+
+// WithValidator configures a function that validates the options once all
+// options have been applied, allowing bad combinations to be rejected.
+func WithValidator(f ValidateFunc) Option {
+	return func(o *Options) error {
+		o.validators = append(o.validators, func(o interface{}) error {
+			return f(o.(*Options))
+		})
+		return nil
+	}
+}
+
+// Exclusive configures the hooks added by `opt` to be exclusive. Options are
+// invalid if any other hooks are configured for the same methods.
+func Exclusive(opt Option) Option {
+	return func(o *Options) error {
+		check, err := validate.Exclusive(o, func() error { return opt(o) })
+		if err != nil {
+			return err
+		}
+		o.validators = append(o.validators, check)
+		return nil
+	}
+}
+
 // WithBeforePut configures a hook that is called _before_ Put.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforePut(f BeforePutFunc) Option {
 	return func(o *Options) error {
-		o.BeforePut = f
+		o.BeforePut = append(o.BeforePut, f)
 		return nil
 	}
 }
 
 // WithAfterPut configures a hook that is called _after_ Put.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterPut(f AfterPutFunc) Option {
 	return func(o *Options) error {
-		o.AfterPut = f
+		o.AfterPut = append(o.AfterPut, f)
 		return nil
 	}
 }
 
 // WithBeforeDelete configures a hook that is called _before_ Delete.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforeDelete(f BeforeDeleteFunc) Option {
 	return func(o *Options) error {
-		o.BeforeDelete = f
+		o.BeforeDelete = append(o.BeforeDelete, f)
 		return nil
 	}
 }
 
 // WithAfterDelete configures a hook that is called _after_ Delete.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterDelete(f AfterDeleteFunc) Option {
 	return func(o *Options) error {
-		o.AfterDelete = f
+		o.AfterDelete = append(o.AfterDelete, f)
 		return nil
 	}
 }
 
 // WithBeforeCommit configures a hook that is called _before_ Commit.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforeCommit(f BeforeCommitFunc) Option {
 	return func(o *Options) error {
-		o.BeforeCommit = f
+		o.BeforeCommit = append(o.BeforeCommit, f)
 		return nil
 	}
 }
 
 // WithAfterCommit configures a hook that is called _after_ Commit.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterCommit(f AfterCommitFunc) Option {
 	return func(o *Options) error {
-		o.AfterCommit = f
+		o.AfterCommit = append(o.AfterCommit, f)
+		return nil
+	}
+}
+
+// WithInterceptor configures middleware that is called around every operation,
+// including the before and after hooks.
+// Multiple interceptors are called in the order they were configured, the
+// first being the outermost.
+func WithInterceptor(i call.Interceptor) Option {
+	return func(o *Options) error {
+		o.Interceptors = append(o.Interceptors, i)
+		return nil
+	}
+}
+
+// WithPanicRecovery causes panics in hooks and interceptors to be recovered and
+// converted into a *call.PanicError that is returned by the hook, so that it is
+// handled like any other hook error. If not nil, `f` is called for each
+// recovered panic, e.g. to log or count it.
+func WithPanicRecovery(f func(*call.PanicError)) Option {
+	return func(o *Options) error {
+		o.panicRecovery = true
+		if f != nil {
+			o.onPanic = append(o.onPanic, f)
+		}
 		return nil
 	}
 }
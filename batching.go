@@ -1,6 +1,9 @@
 package hook
 
 import (
+	"github.com/alanshaw/ipfs-hookds/batch"
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/internal/hookerr"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
 )
@@ -11,9 +14,14 @@ type Batching struct {
 	hds *Datastore
 }
 
-// NewBatching wraps a datastore.Batching datastore and adds optional before and after hooks into it's methods
-func NewBatching(ds datastore.Batching, options ...Option) *Batching {
-	return &Batching{ds: ds, hds: NewDatastore(ds, options...)}
+// NewBatching wraps a datastore.Batching datastore and adds optional before and after hooks into it's methods.
+// It returns an error if any of the options fail or are invalid.
+func NewBatching(ds datastore.Batching, options ...Option) (*Batching, error) {
+	hds, err := NewDatastore(ds, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &Batching{ds: ds, hds: hds}, nil
 }
 
 // Put stores the object `value` named by `key`, it calls OnBeforePut and OnAfterPut hooks.
@@ -31,12 +39,12 @@ func (bds *Batching) Get(key datastore.Key) ([]byte, error) {
 	return bds.hds.Get(key)
 }
 
-// Has returns whether the `key` is mapped to a `value`.
+// Has returns whether the `key` is mapped to a `value`, it calls OnBeforeHas and OnAfterHas hooks.
 func (bds *Batching) Has(key datastore.Key) (bool, error) {
 	return bds.hds.Has(key)
 }
 
-// GetSize returns the size of the `value` named by `key`.
+// GetSize returns the size of the `value` named by `key`, it calls OnBeforeGetSize and OnAfterGetSize hooks.
 func (bds *Batching) GetSize(key datastore.Key) (int, error) {
 	return bds.hds.GetSize(key)
 }
@@ -47,25 +55,90 @@ func (bds *Batching) Query(q query.Query) (query.Results, error) {
 }
 
 // Batch creates a container for a group of updates, it calls OnBeforeBatch and OnAfterBatch hooks.
+// If configured WithBatchPropagation, the batch also calls the Put and Delete hooks.
 func (bds *Batching) Batch() (datastore.Batch, error) {
-	if bds.hds.options.BeforeBatch != nil {
-		bds.hds.options.BeforeBatch()
+	o := bds.hds.options()
+	op := call.Op{Call: call.New("Datastore.Batch")}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		for _, f := range o.BeforeBatch {
+			f(c)
+		}
+		bch, err := bds.ds.Batch()
+		if err == nil {
+			bch = newWatchBatch(bds.hds, bch)
+		}
+		if err == nil && len(o.BatchOptions) > 0 {
+			bch, err = hookBatch(o, bch)
+		}
+		if err == nil && (o.BatchPropagation || len(o.Interceptors) > 0) {
+			bch, err = propagate(o, bch)
+		}
+		for _, f := range o.AfterBatch {
+			prev := err
+			bch, err = f(c, bch, prev)
+			err = hookerr.Wrap(c, "AfterBatch", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{Batch: bch, Err: err}
+	})
+	return result.Batch, result.Err
+}
+
+// hookBatch wraps a batch with the batch options in `o`, recovering batch hooks
+// from panics if configured WithPanicRecovery.
+func hookBatch(o *Options, bch datastore.Batch) (datastore.Batch, error) {
+	options := append([]batch.Option{}, o.BatchOptions...)
+	if o.PanicRecovery {
+		options = append(options, batch.WithPanicRecovery(func(perr *call.PanicError) {
+			for _, f := range o.OnPanic {
+				f(perr)
+			}
+		}))
+	}
+	hbh, err := batch.NewBatch(bch, options...)
+	if err != nil {
+		return nil, err
+	}
+	return hbh, nil
+}
+
+// propagate wraps a batch so that the interceptors in `o` are called for it's
+// operations and, if configured WithBatchPropagation, the Put and Delete hooks
+// in `o` are called for it's Put and Delete.
+func propagate(o *Options, bch datastore.Batch) (datastore.Batch, error) {
+	var options []batch.Option
+	if o.BatchPropagation {
+		for _, f := range o.BeforePut {
+			options = append(options, batch.WithBeforePut(batch.BeforePutFunc(f)))
+		}
+		for _, f := range o.AfterPut {
+			options = append(options, batch.WithAfterPut(batch.AfterPutFunc(f)))
+		}
+		for _, f := range o.BeforeDelete {
+			options = append(options, batch.WithBeforeDelete(batch.BeforeDeleteFunc(f)))
+		}
+		for _, f := range o.AfterDelete {
+			options = append(options, batch.WithAfterDelete(batch.AfterDeleteFunc(f)))
+		}
+	}
+	for _, i := range o.Interceptors {
+		options = append(options, batch.WithInterceptor(i))
 	}
-	bch, err := bds.ds.Batch()
-	if bds.hds.options.AfterBatch != nil {
-		bch, err = bds.hds.options.AfterBatch(bch, err)
+	hbh, err := batch.NewBatch(bch, options...)
+	if err != nil {
+		return nil, err
 	}
-	return bch, err
+	return hbh, nil
 }
 
 // Sync guarantees that any Put or Delete calls under prefix that returned
 // before Sync(prefix) was called will be observed after Sync(prefix)
-// returns, even if the program crashes.
+// returns, even if the program crashes, it calls OnBeforeSync and OnAfterSync hooks.
 func (bds *Batching) Sync(prefix datastore.Key) error {
 	return bds.hds.Sync(prefix)
 }
 
-// Close closes the underlying datastore
+// Close closes the underlying datastore, it calls OnBeforeClose and OnAfterClose hooks.
 func (bds *Batching) Close() error {
 	return bds.hds.Close()
 }
@@ -4,12 +4,19 @@ import (
 	"bytes"
 	"testing"
 
+	"github.com/alanshaw/ipfs-hookds/batch"
+	"github.com/alanshaw/ipfs-hookds/call"
 	"github.com/ipfs/go-datastore"
 )
 
 func TestIsBatching(t *testing.T) {
+	bds, err := NewBatching(datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
 	// ensure it implements datastore.Batching
-	var bds datastore.Batching = NewBatching(datastore.NewMapDatastore())
+	var _ datastore.Batching = bds
 	bds.Close()
 }
 
@@ -20,17 +27,20 @@ func TestBatchingHookBatch(t *testing.T) {
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
-	onBeforeBatch := func() {
+	onBeforeBatch := func(c *call.Call) {
 		beforeHookCalled = true
 	}
 
-	onAfterBatch := func(bch datastore.Batch, err error) (datastore.Batch, error) {
+	onAfterBatch := func(c *call.Call, bch datastore.Batch, err error) (datastore.Batch, error) {
 		afterHookCalled = true
 		return bch, err
 	}
 
 	ds := datastore.NewMapDatastore()
-	bds := NewBatching(ds, WithBeforeBatch(onBeforeBatch), WithAfterBatch(onAfterBatch))
+	bds, err := NewBatching(ds, WithBeforeBatch(onBeforeBatch), WithAfterBatch(onAfterBatch))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 	defer bds.Close()
 
 	bch, err := bds.Batch()
@@ -64,7 +74,7 @@ func TestBatchingHookPut(t *testing.T) {
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
-	onBeforePut := func(k datastore.Key, v []byte) (datastore.Key, []byte) {
+	onBeforePut := func(c *call.Call, k datastore.Key, v []byte) (datastore.Key, []byte, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
@@ -72,10 +82,10 @@ func TestBatchingHookPut(t *testing.T) {
 			t.Fatal("incorrect value")
 		}
 		beforeHookCalled = true
-		return k, v
+		return k, v, nil
 	}
 
-	onAfterPut := func(k datastore.Key, v []byte, err error) error {
+	onAfterPut := func(c *call.Call, k datastore.Key, v []byte, err error) error {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
@@ -87,10 +97,13 @@ func TestBatchingHookPut(t *testing.T) {
 	}
 
 	ds := datastore.NewMapDatastore()
-	bds := NewBatching(ds, WithBeforePut(onBeforePut), WithAfterPut(onAfterPut))
+	bds, err := NewBatching(ds, WithBeforePut(onBeforePut), WithAfterPut(onAfterPut))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 	defer bds.Close()
 
-	err := bds.Put(key, value)
+	err = bds.Put(key, value)
 	if err != nil {
 		t.Fatal("unexpected error", err)
 	}
@@ -111,15 +124,15 @@ func TestBatchingHookGet(t *testing.T) {
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
-	onBeforeGet := func(k datastore.Key) datastore.Key {
+	onBeforeGet := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
 		beforeHookCalled = true
-		return k
+		return k, nil
 	}
 
-	onAfterGet := func(k datastore.Key, v []byte, err error) ([]byte, error) {
+	onAfterGet := func(c *call.Call, k datastore.Key, v []byte, err error) ([]byte, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
@@ -131,10 +144,13 @@ func TestBatchingHookGet(t *testing.T) {
 	}
 
 	ds := datastore.NewMapDatastore()
-	bds := NewBatching(ds, WithBeforeGet(onBeforeGet), WithAfterGet(onAfterGet))
+	bds, err := NewBatching(ds, WithBeforeGet(onBeforeGet), WithAfterGet(onAfterGet))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 	defer bds.Close()
 
-	err := bds.Put(key, value)
+	err = bds.Put(key, value)
 	if err != nil {
 		t.Fatal("unexpected error", err)
 	}
@@ -164,24 +180,27 @@ func TestBatchingHookDelete(t *testing.T) {
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
-	onBeforeDelete := func(k datastore.Key) datastore.Key {
+	onBeforeDelete := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
 		beforeHookCalled = true
-		return k
+		return k, nil
 	}
 
-	onAfterDelete := func(k datastore.Key, err error) error {
+	onAfterDelete := func(c *call.Call, k datastore.Key, err error) error {
 		afterHookCalled = true
 		return err
 	}
 
 	ds := datastore.NewMapDatastore()
-	bds := NewBatching(ds, WithBeforeDelete(onBeforeDelete), WithAfterDelete(onAfterDelete))
+	bds, err := NewBatching(ds, WithBeforeDelete(onBeforeDelete), WithAfterDelete(onAfterDelete))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 	defer bds.Close()
 
-	err := bds.Put(key, value)
+	err = bds.Put(key, value)
 	if err != nil {
 		t.Fatal("unexpected error", err)
 	}
@@ -207,15 +226,15 @@ func TestBatchingHookHas(t *testing.T) {
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
-	onBeforeHas := func(k datastore.Key) datastore.Key {
+	onBeforeHas := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
 		beforeHookCalled = true
-		return k
+		return k, nil
 	}
 
-	onAfterHas := func(k datastore.Key, exists bool, err error) (bool, error) {
+	onAfterHas := func(c *call.Call, k datastore.Key, exists bool, err error) (bool, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
@@ -227,10 +246,13 @@ func TestBatchingHookHas(t *testing.T) {
 	}
 
 	ds := datastore.NewMapDatastore()
-	bds := NewBatching(ds, WithBeforeHas(onBeforeHas), WithAfterHas(onAfterHas))
+	bds, err := NewBatching(ds, WithBeforeHas(onBeforeHas), WithAfterHas(onAfterHas))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 	defer bds.Close()
 
-	err := bds.Put(key, value)
+	err = bds.Put(key, value)
 	if err != nil {
 		t.Fatal("unexpected error", err)
 	}
@@ -258,10 +280,13 @@ func TestBatchingHookGetSize(t *testing.T) {
 	value := []byte("test")
 
 	ds := datastore.NewMapDatastore()
-	bds := NewBatching(ds)
+	bds, err := NewBatching(ds)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 	defer bds.Close()
 
-	err := bds.Put(key, value)
+	err = bds.Put(key, value)
 	if err != nil {
 		t.Fatal("unexpected error", err)
 	}
@@ -275,3 +300,159 @@ func TestBatchingHookGetSize(t *testing.T) {
 		t.Fatal("incorrect size")
 	}
 }
+
+func TestBatchingBatchPropagation(t *testing.T) {
+	afterHookCalled := false
+
+	key := datastore.NewKey("test")
+	value := []byte("test")
+
+	onBeforePut := func(c *call.Call, k datastore.Key, v []byte) (datastore.Key, []byte, error) {
+		return k, append([]byte("encoded:"), v...), nil
+	}
+
+	onAfterDelete := func(c *call.Call, k datastore.Key, err error) error {
+		if k != key {
+			t.Fatal("incorrect key")
+		}
+		afterHookCalled = true
+		return err
+	}
+
+	ds := datastore.NewMapDatastore()
+	bds, err := NewBatching(ds, WithBeforePut(onBeforePut), WithAfterDelete(onAfterDelete), WithBatchPropagation())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer bds.Close()
+
+	bch, err := bds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = bch.Put(key, value)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = bch.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	v, err := ds.Get(key)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if string(v) != "encoded:test" {
+		t.Fatal("incorrect value", string(v))
+	}
+
+	bch, err = bds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = bch.Delete(key)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = bch.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if !afterHookCalled {
+		t.Fatal("after hook not called")
+	}
+}
+
+func TestBatchingInterceptor(t *testing.T) {
+	var ops []string
+
+	interceptor := func(op call.Op, next call.Handler) call.Result {
+		ops = append(ops, op.Call.Op())
+		return next(op)
+	}
+
+	ds := datastore.NewMapDatastore()
+	bds, err := NewBatching(ds, WithInterceptor(interceptor))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer bds.Close()
+
+	bch, err := bds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = bch.Put(datastore.NewKey("test"), []byte("test"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = bch.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []string{"Datastore.Batch", "Batch.Put", "Batch.Commit"}
+	if len(ops) != len(expected) {
+		t.Fatal("incorrect intercepted ops", ops)
+	}
+	for i, op := range expected {
+		if ops[i] != op {
+			t.Fatal("incorrect intercepted ops", ops)
+		}
+	}
+}
+
+func TestBatchingBatchOptions(t *testing.T) {
+	onBeforePut := func(c *call.Call, k datastore.Key, v []byte) (datastore.Key, []byte, error) {
+		return datastore.NewKey("enc").Child(k), v, nil
+	}
+
+	var committed []batch.Op
+	onAfterCommit := func(c *call.Call, ops []batch.Op, err error) error {
+		committed = ops
+		return err
+	}
+
+	bds, err := NewBatching(
+		datastore.NewMapDatastore(),
+		WithBeforePut(onBeforePut),
+		WithBatchPropagation(),
+		WithBatchOptions(batch.WithAfterCommit(onAfterCommit)),
+	)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer bds.Close()
+
+	bch, err := bds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = bch.Put(datastore.NewKey("test"), []byte("test"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = bch.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	// batch hooks are called beneath the propagated hooks
+	if len(committed) != 1 || committed[0].Key.String() != "/enc/test" {
+		t.Fatal("incorrect committed ops", committed)
+	}
+
+	_, err = NewBatching(datastore.NewMapDatastore(), WithBatchOptions(batch.WithAfterCommit(nil)))
+	if err == nil {
+		t.Fatal("expected invalid batch options error")
+	}
+}
@@ -0,0 +1,55 @@
+// Package call provides state that is scoped to a single hooked call and is
+// shared by it's before and after hooks.
+package call
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var lastID uint64
+
+// Call is the state of a single hooked call. The same Call is passed to the
+// before and after hooks of the call, so they can use it to pass values (e.g.
+// a start time, a span or a lock token) between each other.
+type Call struct {
+	op string
+	id uint64
+
+	mu     sync.Mutex
+	values map[interface{}]interface{}
+}
+
+// New creates a new Call for the operation named `op`, with a unique ID.
+func New(op string) *Call {
+	return &Call{op: op, id: atomic.AddUint64(&lastID, 1)}
+}
+
+// Op returns the name of the operation, e.g. "Datastore.Put" or "Batch.Commit".
+func (c *Call) Op() string {
+	return c.op
+}
+
+// ID returns the unique ID of this call.
+func (c *Call) ID() uint64 {
+	return c.id
+}
+
+// Set attaches `value` to the call under `key`. As with context.Context, keys
+// should be of an unexported type to avoid collisions between hooks.
+func (c *Call) Set(key, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = map[interface{}]interface{}{}
+	}
+	c.values[key] = value
+}
+
+// Value returns the value attached to the call under `key`, or nil if there is
+// no such value.
+func (c *Call) Value(key interface{}) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
@@ -0,0 +1,32 @@
+package call
+
+import "testing"
+
+type testKey struct{}
+
+func TestCall(t *testing.T) {
+	c0 := New("Datastore.Put")
+	c1 := New("Datastore.Put")
+
+	if c0.Op() != "Datastore.Put" {
+		t.Fatal("incorrect op")
+	}
+
+	if c0.ID() == c1.ID() {
+		t.Fatal("expected unique call IDs")
+	}
+
+	if c0.Value(testKey{}) != nil {
+		t.Fatal("unexpected value")
+	}
+
+	c0.Set(testKey{}, "test")
+
+	if c0.Value(testKey{}) != "test" {
+		t.Fatal("incorrect value")
+	}
+
+	if c1.Value(testKey{}) != nil {
+		t.Fatal("unexpected value")
+	}
+}
@@ -0,0 +1,33 @@
+package call
+
+import (
+	"fmt"
+
+	"github.com/ipfs/go-datastore"
+)
+
+// HookError is the error returned by a hooked operation when a hook fails it,
+// i.e. a before hook returns an error or an after hook returns an error other
+// than the one it was passed. It allows errors from hooks to be told apart from
+// errors from the wrapped datastore, while errors.Is and errors.As can still be
+// used to inspect the error the hook returned, e.g. datastore.ErrNotFound.
+type HookError struct {
+	// Op is the name of the operation, e.g. "Datastore.Put".
+	Op string
+	// Hook is the kind of hook that failed, e.g. "AfterPut", and Func is the
+	// name of it's function.
+	Hook string
+	Func string
+	// Key is the key passed to the operation, if it has one.
+	Key datastore.Key
+	// Err is the error the hook returned.
+	Err error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("hook: %s (%s) failed %s(%s): %s", e.Hook, e.Func, e.Op, e.Key, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
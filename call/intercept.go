@@ -0,0 +1,59 @@
+package call
+
+import (
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Op is a hooked operation and it's arguments. Only the arguments of the
+// operation named by Call.Op() are set.
+type Op struct {
+	Call *Call
+
+	Key      datastore.Key
+	Value    []byte
+	TTL      time.Duration
+	Query    query.Query
+	ReadOnly bool
+}
+
+// Result is the result of a hooked operation. Only the results of the
+// operation that was called are set, along with Err.
+type Result struct {
+	Value       []byte
+	Exists      bool
+	Size        int
+	DiskUsage   uint64
+	Expiration  time.Time
+	Results     query.Results
+	Batch       datastore.Batch
+	Txn         datastore.Txn
+	Next        <-chan query.Result
+	QueryResult query.Result
+	OK          bool
+	Entries     []query.Entry
+
+	Err error
+}
+
+// Handler performs an operation, i.e. calls the before hooks, the wrapped
+// method and the after hooks.
+type Handler func(Op) Result
+
+// Interceptor is middleware for every hooked operation. It may inspect or
+// change the operation, call `next` zero or more times and inspect or change
+// the result, e.g. for tracing, retries, timeouts or panic recovery.
+type Interceptor func(op Op, next Handler) Result
+
+// Invoke calls `h` for `op` through the interceptors, the first interceptor
+// being the outermost.
+func Invoke(interceptors []Interceptor, op Op, h Handler) Result {
+	if len(interceptors) == 0 {
+		return h(op)
+	}
+	return interceptors[0](op, func(op Op) Result {
+		return Invoke(interceptors[1:], op, h)
+	})
+}
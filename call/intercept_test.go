@@ -0,0 +1,52 @@
+package call
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+)
+
+func TestInvoke(t *testing.T) {
+	var calls []string
+
+	outer := func(op Op, next Handler) Result {
+		calls = append(calls, "outer")
+		op.Key = op.Key.ChildString("outer")
+		return next(op)
+	}
+
+	inner := func(op Op, next Handler) Result {
+		calls = append(calls, "inner")
+		r := next(op)
+		r.Size++
+		return r
+	}
+
+	op := Op{Call: New("Datastore.GetSize"), Key: datastore.NewKey("test")}
+	r := Invoke([]Interceptor{outer, inner}, op, func(op Op) Result {
+		calls = append(calls, "handler")
+		if op.Key != datastore.NewKey("/test/outer") {
+			t.Fatal("incorrect key")
+		}
+		return Result{Size: 1}
+	})
+
+	if r.Size != 2 {
+		t.Fatal("incorrect result")
+	}
+
+	if len(calls) != 3 || calls[0] != "outer" || calls[1] != "inner" || calls[2] != "handler" {
+		t.Fatal("incorrect call order", calls)
+	}
+}
+
+func TestInvokeNoInterceptors(t *testing.T) {
+	op := Op{Call: New("Datastore.Has")}
+	r := Invoke(nil, op, func(op Op) Result {
+		return Result{Exists: true}
+	})
+
+	if !r.Exists {
+		t.Fatal("incorrect result")
+	}
+}
@@ -0,0 +1,29 @@
+package call
+
+import "fmt"
+
+// PanicError is the error a hook returns in place of panicking when panic
+// recovery is enabled.
+type PanicError struct {
+	// Op is the name of the operation the hook was called for, e.g.
+	// "Datastore.Put".
+	Op string
+	// Hook is the kind of hook that panicked, e.g. "AfterPut", and Func is the
+	// name of it's function.
+	Hook string
+	Func string
+	// Value is the value passed to panic and Stack is the stack trace of the
+	// goroutine at the time it panicked.
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("hook: %s hook %s panicked during %s: %v", e.Hook, e.Func, e.Op, e.Value)
+}
+
+// Unwrap returns the value passed to panic if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
@@ -0,0 +1,267 @@
+// Package changelog provides a durable log of the changes made to a hooked
+// datastore, that consumers can resume reading from after a restart.
+package changelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	hook "github.com/alanshaw/ipfs-hookds"
+	"github.com/alanshaw/ipfs-hookds/batch"
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Entry is a change recorded in the log.
+type Entry struct {
+	// Seq is the sequence number of the entry. Sequence numbers start at 1
+	// and increase by one for every entry recorded.
+	Seq   uint64
+	Type  hook.ChangeType
+	Key   datastore.Key
+	Value []byte
+}
+
+type record struct {
+	Type  hook.ChangeType `json:"type"`
+	Key   string          `json:"key"`
+	Value []byte          `json:"value,omitempty"`
+}
+
+// Log is a durable log of the successful mutations of a hooked datastore,
+// i.e. puts and deletes, including those of committed batches. Entries are
+// stored in a separate datastore, which may be a namespace of another
+// datastore, keyed by their sequence number.
+//
+// Entries are recorded after the mutation succeeds, so a crash between the
+// two may leave a mutation unrecorded.
+type Log struct {
+	ds      datastore.Datastore
+	options Options
+
+	// mu guards first and last, the sequence numbers of the oldest and newest
+	// entries in the log, and serializes writes to the log.
+	mu    sync.Mutex
+	first uint64
+	last  uint64
+}
+
+// New creates a change log that stores it's entries in `ds`, continuing from
+// the entries already stored there.
+func New(ds datastore.Datastore, options ...Option) (*Log, error) {
+	opts := Options{}
+	if err := opts.Apply(options...); err != nil {
+		return nil, err
+	}
+	l := &Log{ds: ds, options: opts}
+
+	first, err := l.edge(query.OrderByKey{})
+	if err != nil {
+		return nil, err
+	}
+	last, err := l.edge(query.OrderByKeyDescending{})
+	if err != nil {
+		return nil, err
+	}
+	l.first, l.last = first, last
+	if l.first == 0 {
+		l.first = 1
+	}
+	return l, nil
+}
+
+// edge returns the sequence number of the first entry in the given order, or
+// zero if the log is empty.
+func (l *Log) edge(order query.Order) (uint64, error) {
+	res, err := l.ds.Query(query.Query{KeysOnly: true, Orders: []query.Order{order}, Limit: 1})
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+	r, ok := res.NextSync()
+	if !ok {
+		return 0, nil
+	}
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	return parseKey(r.Key)
+}
+
+func seqKey(seq uint64) datastore.Key {
+	return datastore.RawKey(fmt.Sprintf("/%020d", seq))
+}
+
+func parseKey(k string) (uint64, error) {
+	seq, err := strconv.ParseUint(datastore.RawKey(k).BaseNamespace(), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("changelog: invalid entry key %s: %s", k, err)
+	}
+	return seq, nil
+}
+
+// Hooks returns the option that configures a hooked datastore to record it's
+// changes in the log. If an entry cannot be recorded the hooked operation
+// returns the error, even though the mutation was made.
+func (l *Log) Hooks() hook.Option {
+	return func(o *hook.Options) error {
+		return o.Apply(
+			hook.WithAfterPut(func(c *call.Call, k datastore.Key, v []byte, err error) error {
+				if err != nil || propagated(c) {
+					return err
+				}
+				return l.record(Entry{Type: hook.ChangePut, Key: k, Value: v})
+			}),
+			hook.WithAfterPutWithTTL(func(c *call.Call, k datastore.Key, v []byte, ttl time.Duration, err error) error {
+				if err != nil {
+					return err
+				}
+				return l.record(Entry{Type: hook.ChangePut, Key: k, Value: v})
+			}),
+			hook.WithAfterDelete(func(c *call.Call, k datastore.Key, err error) error {
+				if err != nil || propagated(c) {
+					return err
+				}
+				return l.record(Entry{Type: hook.ChangeDelete, Key: k})
+			}),
+			hook.WithBatchOptions(l.BatchHooks()),
+		)
+	}
+}
+
+// propagated returns true if the hook is called for a batch operation, i.e.
+// the datastore is configured WithBatchPropagation. Batch operations are only
+// recorded when the batch is committed, by the batch hooks.
+func propagated(c *call.Call) bool {
+	return c.Op() == "Batch.Put" || c.Op() == "Batch.Delete"
+}
+
+// BatchHooks returns the option that configures a hooked batch to record it's
+// changes in the log when it is committed.
+func (l *Log) BatchHooks() batch.Option {
+	return batch.WithAfterCommit(func(c *call.Call, ops []batch.Op, err error) error {
+		if err != nil {
+			return err
+		}
+		entries := make([]Entry, len(ops))
+		for i, op := range ops {
+			if op.Delete {
+				entries[i] = Entry{Type: hook.ChangeDelete, Key: op.Key}
+			} else {
+				entries[i] = Entry{Type: hook.ChangePut, Key: op.Key, Value: op.Value}
+			}
+		}
+		return l.record(entries...)
+	})
+}
+
+// record appends entries to the log, assigning their sequence numbers, and
+// removes entries that are no longer retained.
+func (l *Log) record(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var bch datastore.Batch
+	if bds, ok := l.ds.(datastore.Batching); ok {
+		var err error
+		if bch, err = bds.Batch(); err != nil {
+			return fmt.Errorf("changelog: %s", err)
+		}
+	}
+	put := l.ds.Put
+	if bch != nil {
+		put = bch.Put
+	}
+
+	for i, e := range entries {
+		rec := record{Type: e.Type, Key: e.Key.String()}
+		if l.options.Values {
+			rec.Value = e.Value
+		}
+		buf, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("changelog: %s", err)
+		}
+		if err := put(seqKey(l.last+uint64(i)+1), buf); err != nil {
+			return fmt.Errorf("changelog: %s", err)
+		}
+	}
+	if bch != nil {
+		if err := bch.Commit(); err != nil {
+			return fmt.Errorf("changelog: %s", err)
+		}
+	}
+	l.last += uint64(len(entries))
+
+	if l.options.MaxEntries > 0 && l.last >= uint64(l.options.MaxEntries) {
+		return l.truncate(l.last - uint64(l.options.MaxEntries) + 1)
+	}
+	return nil
+}
+
+// LastSeq returns the sequence number of the newest entry in the log, or zero
+// if no entries have been recorded.
+func (l *Log) LastSeq() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last
+}
+
+// ReadFrom returns up to `limit` entries (all entries if zero), starting with
+// the entry with sequence number `seq`. Entries that have been removed from
+// the log are skipped, so the Seq of the first entry returned may be greater
+// than `seq`.
+func (l *Log) ReadFrom(seq uint64, limit int) ([]Entry, error) {
+	l.mu.Lock()
+	first, last := l.first, l.last
+	l.mu.Unlock()
+
+	if seq < first {
+		seq = first
+	}
+	var entries []Entry
+	for ; seq <= last && (limit == 0 || len(entries) < limit); seq++ {
+		buf, err := l.ds.Get(seqKey(seq))
+		if err == datastore.ErrNotFound {
+			continue // removed since reading first
+		}
+		if err != nil {
+			return nil, fmt.Errorf("changelog: %s", err)
+		}
+		var rec record
+		if err := json.Unmarshal(buf, &rec); err != nil {
+			return nil, fmt.Errorf("changelog: invalid entry %d: %s", seq, err)
+		}
+		entries = append(entries, Entry{Seq: seq, Type: rec.Type, Key: datastore.RawKey(rec.Key), Value: rec.Value})
+	}
+	return entries, nil
+}
+
+// Truncate removes the entries before the entry with sequence number `seq`,
+// e.g. once all consumers have read them. The newest entry is always retained,
+// so that sequence numbers continue from it when the log is reopened.
+func (l *Log) Truncate(seq uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.truncate(seq)
+}
+
+func (l *Log) truncate(seq uint64) error {
+	if seq > l.last {
+		seq = l.last
+	}
+	for ; l.first < seq; l.first++ {
+		if err := l.ds.Delete(seqKey(l.first)); err != nil && err != datastore.ErrNotFound {
+			return fmt.Errorf("changelog: %s", err)
+		}
+	}
+	return nil
+}
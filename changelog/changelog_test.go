@@ -0,0 +1,240 @@
+package changelog
+
+import (
+	"testing"
+
+	hook "github.com/alanshaw/ipfs-hookds"
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+)
+
+func TestLog(t *testing.T) {
+	ds := datastore.NewMapDatastore()
+
+	l, err := New(namespace.Wrap(ds, datastore.NewKey("changelog")), WithValues())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	bds, err := hook.NewBatching(namespace.Wrap(ds, datastore.NewKey("data")), l.Hooks())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = bds.Put(datastore.NewKey("a"), []byte("a"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = bds.Delete(datastore.NewKey("a"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	bch, err := bds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = bch.Put(datastore.NewKey("b"), []byte("b"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = bch.Put(datastore.NewKey("c"), []byte("c"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if l.LastSeq() != 2 {
+		t.Fatal("expected batch not to be recorded before commit")
+	}
+
+	err = bch.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	es, err := l.ReadFrom(2, 0)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(es) != 3 {
+		t.Fatal("incorrect entries", es)
+	}
+	if es[0].Seq != 2 || es[0].Type != hook.ChangeDelete || es[0].Key.String() != "/a" {
+		t.Fatal("incorrect entry", es[0])
+	}
+	if es[2].Seq != 4 || es[2].Type != hook.ChangePut || es[2].Key.String() != "/c" || string(es[2].Value) != "c" {
+		t.Fatal("incorrect entry", es[2])
+	}
+
+	// reopen and resume
+	l, err = New(namespace.Wrap(ds, datastore.NewKey("changelog")))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if l.LastSeq() != 4 {
+		t.Fatal("incorrect last sequence number", l.LastSeq())
+	}
+
+	hds, err := hook.NewDatastore(namespace.Wrap(ds, datastore.NewKey("data")), l.Hooks())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = hds.Put(datastore.NewKey("d"), []byte("d"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	es, err = l.ReadFrom(4, 1)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(es) != 1 || es[0].Seq != 4 {
+		t.Fatal("incorrect entries", es)
+	}
+
+	es, err = l.ReadFrom(5, 0)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(es) != 1 || es[0].Key.String() != "/d" || es[0].Value != nil {
+		t.Fatal("incorrect entries", es)
+	}
+}
+
+func TestLogBatchPropagation(t *testing.T) {
+	ds := datastore.NewMapDatastore()
+
+	l, err := New(namespace.Wrap(ds, datastore.NewKey("changelog")))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	bds, err := hook.NewBatching(namespace.Wrap(ds, datastore.NewKey("data")), l.Hooks(), hook.WithBatchPropagation())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	bch, err := bds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = bch.Put(datastore.NewKey("a"), []byte("a"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = bch.Delete(datastore.NewKey("b"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if l.LastSeq() != 0 {
+		t.Fatal("expected batch not to be recorded before commit", l.LastSeq())
+	}
+
+	err = bch.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	es, err := l.ReadFrom(1, 0)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(es) != 2 || es[0].Key.String() != "/a" || es[1].Type != hook.ChangeDelete {
+		t.Fatal("incorrect entries", es)
+	}
+}
+
+func TestLogBatchPropagationRewrite(t *testing.T) {
+	ds := datastore.NewMapDatastore()
+
+	l, err := New(namespace.Wrap(ds, datastore.NewKey("changelog")))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	onBeforePut := func(c *call.Call, k datastore.Key, v []byte) (datastore.Key, []byte, error) {
+		return datastore.NewKey("enc").Child(k), v, nil
+	}
+
+	data := namespace.Wrap(ds, datastore.NewKey("data"))
+	bds, err := hook.NewBatching(data, hook.WithBeforePut(onBeforePut), l.Hooks(), hook.WithBatchPropagation())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = bds.Put(datastore.NewKey("a"), []byte("a"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	bch, err := bds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = bch.Put(datastore.NewKey("b"), []byte("b"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = bch.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	// the log records the keys that were written
+	es, err := l.ReadFrom(1, 0)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(es) != 2 || es[0].Key.String() != "/enc/a" || es[1].Key.String() != "/enc/b" {
+		t.Fatal("incorrect entries", es)
+	}
+	for _, e := range es {
+		if has, _ := data.Has(e.Key); !has {
+			t.Fatal("expected recorded key to be written", e.Key)
+		}
+	}
+}
+
+func TestLogRetention(t *testing.T) {
+	ds := datastore.NewMapDatastore()
+
+	l, err := New(ds, WithMaxEntries(2))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hds, err := hook.NewDatastore(datastore.NewMapDatastore(), l.Hooks())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		err = hds.Put(datastore.NewKey("test"), []byte("test"))
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+
+	es, err := l.ReadFrom(0, 0)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(es) != 2 || es[0].Seq != 4 || es[1].Seq != 5 {
+		t.Fatal("incorrect entries", es)
+	}
+
+	err = l.Truncate(100)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	es, err = l.ReadFrom(0, 0)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(es) != 1 || es[0].Seq != 5 {
+		t.Fatal("expected newest entry to be retained", es)
+	}
+}
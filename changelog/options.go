@@ -0,0 +1,47 @@
+package changelog
+
+import "fmt"
+
+// Options are change log options.
+type Options struct {
+	// Values causes the values that were put to be recorded.
+	Values bool
+	// MaxEntries is the maximum number of entries retained, older entries are
+	// removed as new entries are recorded. Zero means unlimited.
+	MaxEntries int
+}
+
+// Option is the change log option type.
+type Option func(*Options) error
+
+// Apply applies the given options to this Option.
+func (o *Options) Apply(opts ...Option) error {
+	for i, opt := range opts {
+		if err := opt(o); err != nil {
+			return fmt.Errorf("change log option %d failed: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// WithValues configures the values that were put to be recorded in the log.
+// Defaults to recording keys only.
+func WithValues() Option {
+	return func(o *Options) error {
+		o.Values = true
+		return nil
+	}
+}
+
+// WithMaxEntries configures the maximum number of entries retained in the log.
+// Older entries are removed as new entries are recorded.
+// Defaults to unlimited.
+func WithMaxEntries(n int) Option {
+	return func(o *Options) error {
+		if n < 1 {
+			return fmt.Errorf("invalid max entries %d", n)
+		}
+		o.MaxEntries = n
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+//go:build ignore
+// +build ignore
+
+// This program generates wrap_gen.go, which combines a hooked datastore with
+// the hooked optional interfaces implemented by the datastore it wraps.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// base is the hooked datastore type that is embedded in every combination.
+type base struct {
+	capability string
+	typ        string
+	value      string
+}
+
+// mixin is a hooked optional interface that may be embedded in a combination.
+type mixin struct {
+	capability string
+	typ        string
+}
+
+var bases = []base{
+	{"", "*Datastore", "hds"},
+	{"capBatching", "*Batching", "bds"},
+}
+
+var mixins = []mixin{
+	{"capChecked", "checkedDatastore"},
+	{"capScrubbed", "scrubbedDatastore"},
+	{"capGC", "gcDatastore"},
+	{"capPersistent", "persistentDatastore"},
+	{"capTTL", "ttlDatastore"},
+	{"capTxn", "txnDatastore"},
+}
+
+func main() {
+	var buf bytes.Buffer
+
+	fmt.Fprintln(&buf, "// Code generated by gen_wrap.go; DO NOT EDIT.")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "package hook")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, `import "github.com/ipfs/go-datastore"`)
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "// wrap returns a datastore that implements exactly the interfaces in `caps`.")
+	fmt.Fprintln(&buf, "func wrap(hds *Datastore, bds *Batching, caps capability) datastore.Datastore {")
+	fmt.Fprintln(&buf, "switch caps {")
+
+	for _, b := range bases {
+		for set := 0; set < 1<<len(mixins); set++ {
+			var caps, types, values []string
+			if b.capability != "" {
+				caps = append(caps, b.capability)
+			}
+			for i, m := range mixins {
+				if set&(1<<i) != 0 {
+					caps = append(caps, m.capability)
+					types = append(types, m.typ)
+					values = append(values, fmt.Sprintf("%s{hds}", m.typ))
+				}
+			}
+			if len(caps) == 0 {
+				caps = append(caps, "0")
+			}
+
+			fmt.Fprintf(&buf, "case %s:\n", strings.Join(caps, " | "))
+			if len(types) == 0 {
+				fmt.Fprintf(&buf, "return %s\n", b.value)
+				continue
+			}
+			fmt.Fprintf(&buf, "return struct {\n%s\n%s\n}{%s, %s}\n", b.typ, strings.Join(types, "\n"), b.value, strings.Join(values, ", "))
+		}
+	}
+
+	fmt.Fprintln(&buf, "}")
+	fmt.Fprintln(&buf, `panic("unreachable")`)
+	fmt.Fprintln(&buf, "}")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile("wrap_gen.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
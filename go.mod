@@ -5,4 +5,5 @@ go 1.14
 require (
 	github.com/ipfs/go-datastore v0.4.4
 	github.com/jbenet/goprocess v0.1.4
+	github.com/prometheus/client_golang v1.11.0
 )
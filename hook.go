@@ -1,96 +1,311 @@
 package hook
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/internal/hookerr"
+	"github.com/alanshaw/ipfs-hookds/query/results"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
 )
 
 // Datastore is a wrapper for a datastore that adds optional before and after hooks into it's methods.
 type Datastore struct {
-	ds      datastore.Datastore
-	options Options
+	ds datastore.Datastore
+
+	// mu guards registrations, hooks is an immutable snapshot of the merged
+	// options of all registrations that is read without locking.
+	mu            sync.Mutex
+	registrations []*Options
+	hooks         atomic.Value
+
+	// watchMu guards the watchers and the sequence number of changes.
+	watchMu       sync.Mutex
+	watchers      map[*Watcher]struct{}
+	seq           uint64
+	watchesClosed bool
 }
 
 // NewDatastore wraps a datastore.Datastore datastore and adds optional before and after hooks into it's methods.
-func NewDatastore(ds datastore.Datastore, options ...Option) *Datastore {
+// It returns an error if any of the options fail, are invalid or the hooks cannot be ordered.
+func NewDatastore(ds datastore.Datastore, options ...Option) (*Datastore, error) {
 	opts := Options{}
-	opts.Apply(options...)
-	return &Datastore{ds: ds, options: opts}
+	if err := opts.Apply(options...); err != nil {
+		return nil, err
+	}
+	regs := []*Options{&opts}
+	hooks, err := resolve(regs, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := hooks.validate(); err != nil {
+		return nil, err
+	}
+	hooks.recoverPanics()
+	hds := &Datastore{ds: ds, registrations: regs}
+	hds.hooks.Store(hooks)
+	return hds, nil
 }
 
 // Put stores the object `value` named by `key`, it calls OnBeforePut and OnAfterPut hooks.
 func (hds *Datastore) Put(key datastore.Key, value []byte) error {
-	if hds.options.BeforePut != nil {
-		key, value = hds.options.BeforePut(key, value)
-	}
-	err := hds.ds.Put(key, value)
-	if hds.options.AfterPut != nil {
-		err = hds.options.AfterPut(key, value, err)
-	}
-	return err
+	o := hds.options()
+	op := call.Op{Call: call.New("Datastore.Put"), Key: key, Value: value}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c, key, value := op.Call, op.Key, op.Value
+		var err error
+		for _, f := range o.BeforePut {
+			if key, value, err = f(c, key, value); err != nil {
+				err = hookerr.Wrap(c, "BeforePut", f, op.Key, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			if err = hds.ds.Put(key, value); err == nil {
+				hds.publish(Change{Type: ChangePut, Key: key, Value: value})
+			}
+		}
+		for _, f := range o.AfterPut {
+			prev := err
+			err = f(c, key, value, prev)
+			err = hookerr.Wrap(c, "AfterPut", f, op.Key, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
 }
 
 // Delete removes the value for given `key`, it calls OnBeforeDelete and OnAfterDelete hooks.
 func (hds *Datastore) Delete(key datastore.Key) error {
-	if hds.options.BeforeDelete != nil {
-		key = hds.options.BeforeDelete(key)
-	}
-	err := hds.ds.Delete(key)
-	if hds.options.AfterDelete != nil {
-		err = hds.options.AfterDelete(key, err)
-	}
-	return err
+	o := hds.options()
+	op := call.Op{Call: call.New("Datastore.Delete"), Key: key}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c, key := op.Call, op.Key
+		var err error
+		for _, f := range o.BeforeDelete {
+			if key, err = f(c, key); err != nil {
+				err = hookerr.Wrap(c, "BeforeDelete", f, op.Key, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			if err = hds.ds.Delete(key); err == nil {
+				hds.publish(Change{Type: ChangeDelete, Key: key})
+			}
+		}
+		for _, f := range o.AfterDelete {
+			prev := err
+			err = f(c, key, prev)
+			err = hookerr.Wrap(c, "AfterDelete", f, op.Key, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
 }
 
 // Get retrieves the object `value` named by `key`, it calls OnBeforeGet and OnAfterGet hooks.
 func (hds *Datastore) Get(key datastore.Key) ([]byte, error) {
-	if hds.options.BeforeGet != nil {
-		key = hds.options.BeforeGet(key)
-	}
-	value, err := hds.ds.Get(key)
-	if hds.options.AfterGet != nil {
-		value, err = hds.options.AfterGet(key, value, err)
-	}
-	return value, err
+	o := hds.options()
+	op := call.Op{Call: call.New("Datastore.Get"), Key: key}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c, key := op.Call, op.Key
+		var err error
+		for _, f := range o.BeforeGet {
+			if key, err = f(c, key); err != nil {
+				err = hookerr.Wrap(c, "BeforeGet", f, op.Key, nil, err)
+				break
+			}
+		}
+		var value []byte
+		var sc *ShortCircuit
+		if errors.As(err, &sc) {
+			value, err = sc.Value, nil
+		} else if err == nil {
+			value, err = hds.ds.Get(key)
+		}
+		for _, f := range o.AfterGet {
+			prev := err
+			value, err = f(c, key, value, prev)
+			err = hookerr.Wrap(c, "AfterGet", f, op.Key, prev, err)
+		}
+		return call.Result{Value: value, Err: err}
+	})
+	return result.Value, result.Err
 }
 
-// Has returns whether the `key` is mapped to a `value`.
+// Has returns whether the `key` is mapped to a `value`, it calls OnBeforeHas and OnAfterHas hooks.
 func (hds *Datastore) Has(key datastore.Key) (bool, error) {
-	if hds.options.BeforeHas != nil {
-		key = hds.options.BeforeHas(key)
-	}
-	exists, err := hds.ds.Has(key)
-	if hds.options.AfterHas != nil {
-		exists, err = hds.options.AfterHas(key, exists, err)
-	}
-	return exists, err
+	o := hds.options()
+	op := call.Op{Call: call.New("Datastore.Has"), Key: key}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c, key := op.Call, op.Key
+		var err error
+		for _, f := range o.BeforeHas {
+			if key, err = f(c, key); err != nil {
+				err = hookerr.Wrap(c, "BeforeHas", f, op.Key, nil, err)
+				break
+			}
+		}
+		var exists bool
+		var sc *ShortCircuit
+		if errors.As(err, &sc) {
+			exists, err = sc.Exists, nil
+		} else if err == nil {
+			exists, err = hds.ds.Has(key)
+		}
+		for _, f := range o.AfterHas {
+			prev := err
+			exists, err = f(c, key, exists, prev)
+			err = hookerr.Wrap(c, "AfterHas", f, op.Key, prev, err)
+		}
+		return call.Result{Exists: exists, Err: err}
+	})
+	return result.Exists, result.Err
 }
 
-// GetSize returns the size of the `value` named by `key`.
+// GetSize returns the size of the `value` named by `key`, it calls OnBeforeGetSize and OnAfterGetSize hooks.
 func (hds *Datastore) GetSize(key datastore.Key) (int, error) {
-	return hds.ds.GetSize(key)
+	o := hds.options()
+	op := call.Op{Call: call.New("Datastore.GetSize"), Key: key}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c, key := op.Call, op.Key
+		var err error
+		for _, f := range o.BeforeGetSize {
+			if key, err = f(c, key); err != nil {
+				err = hookerr.Wrap(c, "BeforeGetSize", f, op.Key, nil, err)
+				break
+			}
+		}
+		var size int
+		if err == nil {
+			size, err = hds.ds.GetSize(key)
+		}
+		for _, f := range o.AfterGetSize {
+			prev := err
+			size, err = f(c, key, size, prev)
+			err = hookerr.Wrap(c, "AfterGetSize", f, op.Key, prev, err)
+		}
+		return call.Result{Size: size, Err: err}
+	})
+	return result.Size, result.Err
 }
 
 // Query searches the datastore and returns a query result, it calls OnBeforeQuery and OnAfterQuery hooks.
 func (hds *Datastore) Query(q query.Query) (query.Results, error) {
-	if hds.options.BeforeQuery != nil {
-		q = hds.options.BeforeQuery(q)
-	}
-	res, err := hds.ds.Query(q)
-	if hds.options.AfterQuery != nil {
-		res, err = hds.options.AfterQuery(q, res, err)
-	}
-	return res, err
+	o := hds.options()
+	op := call.Op{Call: call.New("Datastore.Query"), Query: q}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c, q := op.Call, op.Query
+		var err error
+		for _, f := range o.BeforeQuery {
+			if q, err = f(c, q); err != nil {
+				err = hookerr.Wrap(c, "BeforeQuery", f, datastore.Key{}, nil, err)
+				break
+			}
+		}
+		var res query.Results
+		if err == nil {
+			res, err = hds.ds.Query(q)
+		}
+		if err == nil && (len(o.Interceptors) > 0 || len(o.ResultsOptions) > 0) {
+			res, err = hookResults(o, res)
+		}
+		for _, f := range o.AfterQuery {
+			prev := err
+			res, err = f(c, q, res, prev)
+			err = hookerr.Wrap(c, "AfterQuery", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{Results: res, Err: err}
+	})
+	return result.Results, result.Err
 }
 
 // Sync guarantees that any Put or Delete calls under prefix that returned
 // before Sync(prefix) was called will be observed after Sync(prefix)
-// returns, even if the program crashes.
+// returns, even if the program crashes, it calls OnBeforeSync and OnAfterSync hooks.
 func (hds *Datastore) Sync(prefix datastore.Key) error {
-	return hds.ds.Sync(prefix)
+	o := hds.options()
+	op := call.Op{Call: call.New("Datastore.Sync"), Key: prefix}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c, prefix := op.Call, op.Key
+		var err error
+		for _, f := range o.BeforeSync {
+			if prefix, err = f(c, prefix); err != nil {
+				err = hookerr.Wrap(c, "BeforeSync", f, op.Key, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			err = hds.ds.Sync(prefix)
+		}
+		for _, f := range o.AfterSync {
+			prev := err
+			err = f(c, prefix, prev)
+			err = hookerr.Wrap(c, "AfterSync", f, op.Key, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
 }
 
-// Close closes the underlying datastore
+// Close closes the underlying datastore, it calls OnBeforeClose and OnAfterClose hooks.
 func (hds *Datastore) Close() error {
-	return hds.ds.Close()
+	o := hds.options()
+	op := call.Op{Call: call.New("Datastore.Close")}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		var err error
+		for _, f := range o.BeforeClose {
+			if err = f(c); err != nil {
+				err = hookerr.Wrap(c, "BeforeClose", f, datastore.Key{}, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			if err = hds.ds.Close(); err == nil {
+				hds.closeWatchers()
+			}
+		}
+		for _, f := range o.AfterClose {
+			prev := err
+			err = f(c, prev)
+			err = hookerr.Wrap(c, "AfterClose", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
+}
+
+// hookResults wraps query results so that the interceptors in `o` are called
+// for it's operations and the results options in `o` are applied to it. The
+// results are closed if the options fail.
+func hookResults(o *Options, res query.Results) (query.Results, error) {
+	var options []results.Option
+	for _, i := range o.Interceptors {
+		options = append(options, results.WithInterceptor(i))
+	}
+	options = append(options, resultsOptions(o)...)
+	hres, err := results.NewResults(res, options...)
+	if err != nil {
+		res.Close()
+		return nil, err
+	}
+	return hres, nil
+}
+
+// resultsOptions returns the results options in `o`, recovering results hooks
+// from panics if configured WithPanicRecovery.
+func resultsOptions(o *Options) []results.Option {
+	options := append([]results.Option{}, o.ResultsOptions...)
+	if o.PanicRecovery {
+		options = append(options, results.WithPanicRecovery(func(perr *call.PanicError) {
+			for _, f := range o.OnPanic {
+				f(perr)
+			}
+		}))
+	}
+	return options
 }
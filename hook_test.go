@@ -2,14 +2,24 @@ package hook
 
 import (
 	"bytes"
+	"errors"
+	"strings"
 	"testing"
 
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/query/results"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
 )
 
 func TestIsDatastore(t *testing.T) {
+	hds, err := NewDatastore(datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
 	// ensure it implements datastore.Datastore
-	var hds datastore.Datastore = NewDatastore(datastore.NewMapDatastore())
+	var _ datastore.Datastore = hds
 	hds.Close()
 }
 
@@ -20,7 +30,7 @@ func TestHookPut(t *testing.T) {
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
-	onBeforePut := func(k datastore.Key, v []byte) (datastore.Key, []byte) {
+	onBeforePut := func(c *call.Call, k datastore.Key, v []byte) (datastore.Key, []byte, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
@@ -28,10 +38,10 @@ func TestHookPut(t *testing.T) {
 			t.Fatal("incorrect value")
 		}
 		beforeHookCalled = true
-		return k, v
+		return k, v, nil
 	}
 
-	onAfterPut := func(k datastore.Key, v []byte, err error) error {
+	onAfterPut := func(c *call.Call, k datastore.Key, v []byte, err error) error {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
@@ -43,10 +53,13 @@ func TestHookPut(t *testing.T) {
 	}
 
 	ds := datastore.NewMapDatastore()
-	hds := NewDatastore(ds, WithBeforePut(onBeforePut), WithAfterPut(onAfterPut))
+	hds, err := NewDatastore(ds, WithBeforePut(onBeforePut), WithAfterPut(onAfterPut))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 	defer hds.Close()
 
-	err := hds.Put(key, value)
+	err = hds.Put(key, value)
 	if err != nil {
 		t.Fatal("unexpected error", err)
 	}
@@ -67,15 +80,15 @@ func TestHookGet(t *testing.T) {
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
-	onBeforeGet := func(k datastore.Key) datastore.Key {
+	onBeforeGet := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
 		beforeHookCalled = true
-		return k
+		return k, nil
 	}
 
-	onAfterGet := func(k datastore.Key, v []byte, err error) ([]byte, error) {
+	onAfterGet := func(c *call.Call, k datastore.Key, v []byte, err error) ([]byte, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
@@ -87,10 +100,13 @@ func TestHookGet(t *testing.T) {
 	}
 
 	ds := datastore.NewMapDatastore()
-	hds := NewDatastore(ds, WithBeforeGet(onBeforeGet), WithAfterGet(onAfterGet))
+	hds, err := NewDatastore(ds, WithBeforeGet(onBeforeGet), WithAfterGet(onAfterGet))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 	defer hds.Close()
 
-	err := hds.Put(key, value)
+	err = hds.Put(key, value)
 	if err != nil {
 		t.Fatal("unexpected error", err)
 	}
@@ -120,15 +136,15 @@ func TestHookDelete(t *testing.T) {
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
-	onBeforeDelete := func(k datastore.Key) datastore.Key {
+	onBeforeDelete := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
 		beforeHookCalled = true
-		return k
+		return k, nil
 	}
 
-	onAfterDelete := func(k datastore.Key, err error) error {
+	onAfterDelete := func(c *call.Call, k datastore.Key, err error) error {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
@@ -137,10 +153,13 @@ func TestHookDelete(t *testing.T) {
 	}
 
 	ds := datastore.NewMapDatastore()
-	hds := NewDatastore(ds, WithBeforeDelete(onBeforeDelete), WithAfterDelete(onAfterDelete))
+	hds, err := NewDatastore(ds, WithBeforeDelete(onBeforeDelete), WithAfterDelete(onAfterDelete))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 	defer hds.Close()
 
-	err := hds.Put(key, value)
+	err = hds.Put(key, value)
 	if err != nil {
 		t.Fatal("unexpected error", err)
 	}
@@ -166,15 +185,15 @@ func TestHookHas(t *testing.T) {
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
-	onBeforeHas := func(k datastore.Key) datastore.Key {
+	onBeforeHas := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
 		beforeHookCalled = true
-		return k
+		return k, nil
 	}
 
-	onAfterHas := func(k datastore.Key, exists bool, err error) (bool, error) {
+	onAfterHas := func(c *call.Call, k datastore.Key, exists bool, err error) (bool, error) {
 		if k != key {
 			t.Fatal("incorrect key")
 		}
@@ -183,10 +202,13 @@ func TestHookHas(t *testing.T) {
 	}
 
 	ds := datastore.NewMapDatastore()
-	hds := NewDatastore(ds, WithBeforeHas(onBeforeHas), WithAfterHas(onAfterHas))
+	hds, err := NewDatastore(ds, WithBeforeHas(onBeforeHas), WithAfterHas(onAfterHas))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 	defer hds.Close()
 
-	err := hds.Put(key, value)
+	err = hds.Put(key, value)
 	if err != nil {
 		t.Fatal("unexpected error", err)
 	}
@@ -210,14 +232,39 @@ func TestHookHas(t *testing.T) {
 }
 
 func TestHookGetSize(t *testing.T) {
+	beforeHookCalled := false
+	afterHookCalled := false
+
 	key := datastore.NewKey("test")
 	value := []byte("test")
 
+	onBeforeGetSize := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
+		if k != key {
+			t.Fatal("incorrect key")
+		}
+		beforeHookCalled = true
+		return k, nil
+	}
+
+	onAfterGetSize := func(c *call.Call, k datastore.Key, size int, err error) (int, error) {
+		if k != key {
+			t.Fatal("incorrect key")
+		}
+		if size != len(value) {
+			t.Fatal("incorrect size")
+		}
+		afterHookCalled = true
+		return size, err
+	}
+
 	ds := datastore.NewMapDatastore()
-	hds := NewDatastore(ds)
+	hds, err := NewDatastore(ds, WithBeforeGetSize(onBeforeGetSize), WithAfterGetSize(onAfterGetSize))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
 	defer hds.Close()
 
-	err := hds.Put(key, value)
+	err = hds.Put(key, value)
 	if err != nil {
 		t.Fatal("unexpected error", err)
 	}
@@ -230,4 +277,705 @@ func TestHookGetSize(t *testing.T) {
 	if size != len(value) {
 		t.Fatal("incorrect size")
 	}
+
+	if !beforeHookCalled {
+		t.Fatal("before hook not called")
+	}
+
+	if !afterHookCalled {
+		t.Fatal("after hook not called")
+	}
+}
+
+func TestHookSync(t *testing.T) {
+	beforeHookCalled := false
+	afterHookCalled := false
+
+	prefix := datastore.NewKey("test")
+
+	onBeforeSync := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
+		if k != prefix {
+			t.Fatal("incorrect prefix")
+		}
+		beforeHookCalled = true
+		return k, nil
+	}
+
+	onAfterSync := func(c *call.Call, k datastore.Key, err error) error {
+		if k != prefix {
+			t.Fatal("incorrect prefix")
+		}
+		afterHookCalled = true
+		return err
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, WithBeforeSync(onBeforeSync), WithAfterSync(onAfterSync))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	err = hds.Sync(prefix)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if !beforeHookCalled {
+		t.Fatal("before hook not called")
+	}
+
+	if !afterHookCalled {
+		t.Fatal("after hook not called")
+	}
+}
+
+func TestHookClose(t *testing.T) {
+	var calls []string
+
+	onBeforeClose0 := func(c *call.Call) error {
+		calls = append(calls, "before0")
+		return nil
+	}
+
+	onBeforeClose1 := func(c *call.Call) error {
+		calls = append(calls, "before1")
+		return nil
+	}
+
+	onAfterClose := func(c *call.Call, err error) error {
+		calls = append(calls, "after")
+		return err
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, WithBeforeClose(onBeforeClose0), WithBeforeClose(onBeforeClose1), WithAfterClose(onAfterClose))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = hds.Close()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(calls) != 3 || calls[0] != "before0" || calls[1] != "before1" || calls[2] != "after" {
+		t.Fatal("incorrect hook call order", calls)
+	}
+}
+
+func TestHookPutMultiple(t *testing.T) {
+	var calls []string
+
+	key := datastore.NewKey("test")
+	value := []byte("test")
+
+	onBeforePut0 := func(c *call.Call, k datastore.Key, v []byte) (datastore.Key, []byte, error) {
+		calls = append(calls, "before0")
+		return k.ChildString("0"), v, nil
+	}
+
+	onBeforePut1 := func(c *call.Call, k datastore.Key, v []byte) (datastore.Key, []byte, error) {
+		if k != key.ChildString("0") {
+			t.Fatal("incorrect key")
+		}
+		calls = append(calls, "before1")
+		return k.ChildString("1"), v, nil
+	}
+
+	onAfterPut0 := func(c *call.Call, k datastore.Key, v []byte, err error) error {
+		calls = append(calls, "after0")
+		return err
+	}
+
+	onAfterPut1 := func(c *call.Call, k datastore.Key, v []byte, err error) error {
+		calls = append(calls, "after1")
+		return err
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(
+		ds,
+		WithBeforePut(onBeforePut0),
+		WithBeforePut(onBeforePut1),
+		WithAfterPut(onAfterPut0),
+		WithAfterPut(onAfterPut1),
+	)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	err = hds.Put(key, value)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	exists, err := ds.Has(key.ChildString("0").ChildString("1"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if !exists {
+		t.Fatal("expected transformed key to exist")
+	}
+
+	expected := []string{"before0", "before1", "after0", "after1"}
+	if len(calls) != len(expected) {
+		t.Fatal("incorrect number of hook calls", calls)
+	}
+	for i, c := range expected {
+		if calls[i] != c {
+			t.Fatal("incorrect hook call order", calls)
+		}
+	}
+}
+
+func TestHookPutBeforeError(t *testing.T) {
+	afterHookCalled := false
+
+	key := datastore.NewKey("test")
+	value := []byte("test")
+	rejected := errors.New("rejected")
+
+	onBeforePut := func(c *call.Call, k datastore.Key, v []byte) (datastore.Key, []byte, error) {
+		return k, v, rejected
+	}
+
+	onAfterPut := func(c *call.Call, k datastore.Key, v []byte, err error) error {
+		if !errors.Is(err, rejected) {
+			t.Fatal("expected before hook error", err)
+		}
+		afterHookCalled = true
+		return err
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, WithBeforePut(onBeforePut), WithAfterPut(onAfterPut))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	err = hds.Put(key, value)
+	if !errors.Is(err, rejected) {
+		t.Fatal("expected before hook error", err)
+	}
+
+	exists, err := ds.Has(key)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if exists {
+		t.Fatal("expected key not to be put")
+	}
+
+	if !afterHookCalled {
+		t.Fatal("after hook not called")
+	}
+}
+
+func TestHookGetShortCircuit(t *testing.T) {
+	afterHookCalled := false
+
+	key := datastore.NewKey("test")
+	value := []byte("cached")
+
+	onBeforeGet := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
+		return k, ShortCircuitGet(value)
+	}
+
+	onAfterGet := func(c *call.Call, k datastore.Key, v []byte, err error) ([]byte, error) {
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if bytes.Compare(v, value) != 0 {
+			t.Fatal("incorrect value")
+		}
+		afterHookCalled = true
+		return v, err
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, WithBeforeGet(onBeforeGet), WithAfterGet(onAfterGet))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	// key is not in the wrapped datastore
+	v, err := hds.Get(key)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if bytes.Compare(v, value) != 0 {
+		t.Fatal("incorrect value")
+	}
+
+	if !afterHookCalled {
+		t.Fatal("after hook not called")
+	}
+}
+
+func TestHookHasShortCircuit(t *testing.T) {
+	key := datastore.NewKey("test")
+	value := []byte("test")
+
+	onBeforeHas := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
+		return k, ShortCircuitHas(false)
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, WithBeforeHas(onBeforeHas))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	err = hds.Put(key, value)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	exists, err := hds.Has(key)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if exists {
+		t.Fatal("expected short circuited result")
+	}
+}
+
+func TestNewDatastoreOptionError(t *testing.T) {
+	failed := errors.New("failed")
+
+	opt := func(o *Options) error {
+		return failed
+	}
+
+	_, err := NewDatastore(datastore.NewMapDatastore(), opt)
+	if err == nil {
+		t.Fatal("expected option error")
+	}
+}
+
+func TestNewDatastoreNilHook(t *testing.T) {
+	_, err := NewDatastore(datastore.NewMapDatastore(), WithBeforePut(nil))
+	if err == nil {
+		t.Fatal("expected nil hook error")
+	}
+}
+
+func TestNewDatastoreExclusive(t *testing.T) {
+	onBeforeGet := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
+		return k, nil
+	}
+
+	onAfterGet := func(c *call.Call, k datastore.Key, v []byte, err error) ([]byte, error) {
+		return v, err
+	}
+
+	ds := datastore.NewMapDatastore()
+
+	hds, err := NewDatastore(ds, Exclusive(WithBeforeGet(onBeforeGet)), WithAfterGet(onAfterGet))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	hds.Close()
+
+	_, err = NewDatastore(ds, Exclusive(WithBeforeGet(onBeforeGet)), WithBeforeGet(onBeforeGet))
+	if err == nil {
+		t.Fatal("expected conflicting exclusive hook error")
+	}
+}
+
+func TestNewDatastoreValidator(t *testing.T) {
+	invalid := errors.New("invalid")
+
+	validator := func(o *Options) error {
+		if len(o.AfterPut) == 0 {
+			return invalid
+		}
+		return nil
+	}
+
+	_, err := NewDatastore(datastore.NewMapDatastore(), WithValidator(validator))
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+}
+
+type startKey struct{}
+
+func TestHookCallState(t *testing.T) {
+	afterHookCalled := false
+
+	var beforeCall *call.Call
+
+	onBeforePut := func(c *call.Call, k datastore.Key, v []byte) (datastore.Key, []byte, error) {
+		if c.Op() != "Datastore.Put" {
+			t.Fatal("incorrect op", c.Op())
+		}
+		c.Set(startKey{}, "started")
+		beforeCall = c
+		return k, v, nil
+	}
+
+	onAfterPut := func(c *call.Call, k datastore.Key, v []byte, err error) error {
+		if c.ID() != beforeCall.ID() {
+			t.Fatal("incorrect call")
+		}
+		if c.Value(startKey{}) != "started" {
+			t.Fatal("incorrect call value")
+		}
+		afterHookCalled = true
+		return err
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, WithBeforePut(onBeforePut), WithAfterPut(onAfterPut))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	err = hds.Put(datastore.NewKey("test"), []byte("test"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	prevID := beforeCall.ID()
+
+	err = hds.Put(datastore.NewKey("test"), []byte("test"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if beforeCall.ID() == prevID {
+		t.Fatal("expected a new call")
+	}
+
+	if !afterHookCalled {
+		t.Fatal("after hook not called")
+	}
+}
+
+func TestHookInterceptor(t *testing.T) {
+	var ops []string
+
+	key := datastore.NewKey("test")
+	value := []byte("test")
+
+	interceptor := func(op call.Op, next call.Handler) call.Result {
+		ops = append(ops, op.Call.Op())
+		if op.Call.Op() == "Datastore.Get" {
+			return call.Result{Value: []byte("intercepted")}
+		}
+		return next(op)
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, WithInterceptor(interceptor))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	err = hds.Put(key, value)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	v, err := hds.Get(key)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if string(v) != "intercepted" {
+		t.Fatal("incorrect value")
+	}
+
+	res, err := hds.Query(query.Query{})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	_, err = res.Rest()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := []string{"Datastore.Put", "Datastore.Get", "Datastore.Query", "Results.Rest"}
+	if len(ops) != len(expected) {
+		t.Fatal("incorrect intercepted ops", ops)
+	}
+	for i, op := range expected {
+		if ops[i] != op {
+			t.Fatal("incorrect intercepted ops", ops)
+		}
+	}
+}
+
+func TestHookPanicRecovery(t *testing.T) {
+	var recovered *call.PanicError
+
+	onAfterPut := func(c *call.Call, k datastore.Key, v []byte, err error) error {
+		panic("boom")
+	}
+
+	onPanic := func(perr *call.PanicError) {
+		recovered = perr
+	}
+
+	key := datastore.NewKey("test")
+	value := []byte("test")
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, WithAfterPut(onAfterPut), WithPanicRecovery(onPanic))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	err = hds.Put(key, value)
+
+	var perr *call.PanicError
+	if !errors.As(err, &perr) {
+		t.Fatal("expected panic error", err)
+	}
+	if perr.Hook != "AfterPut" || perr.Op != "Datastore.Put" || perr.Value != "boom" || len(perr.Stack) == 0 {
+		t.Fatal("incorrect panic error", perr)
+	}
+	if recovered != perr {
+		t.Fatal("panic handler not called")
+	}
+
+	v, err := ds.Get(key)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if !bytes.Equal(v, value) {
+		t.Fatal("value not stored")
+	}
+}
+
+func TestHookPanicRecoveryInterceptor(t *testing.T) {
+	interceptor := func(op call.Op, next call.Handler) call.Result {
+		next(op)
+		panic("boom")
+	}
+
+	hds, err := NewDatastore(datastore.NewMapDatastore(), WithInterceptor(interceptor), WithPanicRecovery(nil))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	err = hds.Put(datastore.NewKey("test"), []byte("test"))
+
+	var perr *call.PanicError
+	if !errors.As(err, &perr) {
+		t.Fatal("expected panic error", err)
+	}
+	if perr.Hook != "Interceptor" || perr.Op != "Datastore.Put" || perr.Value != "boom" {
+		t.Fatal("incorrect panic error", perr)
+	}
+}
+
+func TestHookPanicNoRecovery(t *testing.T) {
+	onBeforeGet := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
+		panic("boom")
+	}
+
+	hds, err := NewDatastore(datastore.NewMapDatastore(), WithBeforeGet(onBeforeGet))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+
+	hds.Get(datastore.NewKey("test"))
+}
+
+func TestHookError(t *testing.T) {
+	key := datastore.NewKey("test")
+	value := []byte("test")
+
+	onAfterGet := func(c *call.Call, k datastore.Key, v []byte, err error) ([]byte, error) {
+		if k.String() == "/hidden" {
+			return nil, datastore.ErrNotFound
+		}
+		return v, err
+	}
+
+	// the hook is identified with and without the wrapper that recovers panics
+	for _, options := range [][]Option{nil, {WithPanicRecovery(nil)}} {
+		ds := datastore.NewMapDatastore()
+		hds, err := NewDatastore(ds, append(options, WithAfterGet(onAfterGet))...)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		defer hds.Close()
+
+		err = ds.Put(datastore.NewKey("hidden"), value)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+
+		_, err = hds.Get(datastore.NewKey("hidden"))
+
+		var herr *call.HookError
+		if !errors.As(err, &herr) {
+			t.Fatal("expected hook error", err)
+		}
+		if herr.Op != "Datastore.Get" || herr.Hook != "AfterGet" || herr.Key.String() != "/hidden" || !strings.Contains(herr.Func, "TestHookError") {
+			t.Fatal("incorrect hook error", herr)
+		}
+		if !errors.Is(err, datastore.ErrNotFound) {
+			t.Fatal("expected not found error", err)
+		}
+
+		// errors from the datastore passed through by the hook are not hook errors
+		_, err = hds.Get(key)
+		if err != datastore.ErrNotFound {
+			t.Fatal("expected not found error", err)
+		}
+
+		errBatch := errors.New("batch failed")
+		onAfterBatch := func(c *call.Call, b datastore.Batch, err error) (datastore.Batch, error) {
+			return nil, errBatch
+		}
+
+		bds, err := NewBatching(datastore.NewMapDatastore(), append(options, WithAfterBatch(onAfterBatch))...)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		defer bds.Close()
+
+		_, err = bds.Batch()
+		if !errors.As(err, &herr) {
+			t.Fatal("expected hook error", err)
+		}
+		if herr.Op != "Datastore.Batch" || herr.Hook != "AfterBatch" || !strings.Contains(herr.Func, "TestHookError") {
+			t.Fatal("incorrect hook error", herr)
+		}
+		if !errors.Is(err, errBatch) {
+			t.Fatal("expected batch error", err)
+		}
+	}
+}
+
+func TestHookQueryResultsTracker(t *testing.T) {
+	tr := results.NewTracker(0, nil)
+
+	hds, err := NewDatastore(datastore.NewMapDatastore(), WithQueryResults(results.WithTracker(tr)))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hds.Put(datastore.NewKey("test"), []byte("test"))
+
+	res, err := hds.Query(query.Query{Prefix: "/"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	leaks := tr.Leaks()
+	if len(leaks) != 1 || leaks[0].Query.Prefix != "/" {
+		t.Fatal("expected unclosed results to be tracked", leaks)
+	}
+
+	_, err = res.Rest()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if len(tr.Leaks()) != 0 {
+		t.Fatal("expected fully read results not to be tracked", tr.Leaks())
+	}
+}
+
+func TestHookQueryResultsLimits(t *testing.T) {
+	hds, err := NewDatastore(datastore.NewMapDatastore(), WithQueryResults(results.WithMaxEntries(1)))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hds.Put(datastore.NewKey("1"), []byte("test"))
+	hds.Put(datastore.NewKey("2"), []byte("test"))
+
+	res, err := hds.Query(query.Query{})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	es, err := res.Rest()
+	var lerr *results.LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != results.LimitEntries {
+		t.Fatal("expected limit error", err)
+	}
+	if len(es) != 1 {
+		t.Fatal("incorrect entries", es)
+	}
+}
+
+func TestHookQueryResultsInvalid(t *testing.T) {
+	_, err := NewDatastore(datastore.NewMapDatastore(), WithQueryResults(results.WithEntry(nil)))
+	if err == nil {
+		t.Fatal("expected invalid results options error")
+	}
+
+	hds, err := NewDatastore(datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	_, err = hds.AddHook(WithQueryResults(results.WithTracker(nil)))
+	if err == nil {
+		t.Fatal("expected invalid results options error")
+	}
+}
+
+func TestHookQueryResultsPanicRecovery(t *testing.T) {
+	var recovered *call.PanicError
+
+	onEntry := func(c *call.Call, e query.Entry) (query.Entry, bool, error) {
+		panic("boom")
+	}
+
+	hds, err := NewDatastore(
+		datastore.NewMapDatastore(),
+		WithQueryResults(results.WithEntry(onEntry)),
+		WithPanicRecovery(func(perr *call.PanicError) {
+			recovered = perr
+		}),
+	)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hds.Put(datastore.NewKey("test"), []byte("test"))
+
+	res, err := hds.Query(query.Query{})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer res.Close()
+
+	r, _ := res.NextSync()
+
+	var perr *call.PanicError
+	if !errors.As(r.Error, &perr) || perr.Hook != "Entry" || perr.Op != "Results.NextSync" {
+		t.Fatal("expected panic error", r.Error)
+	}
+	if recovered != perr {
+		t.Fatal("panic handler not called")
+	}
 }
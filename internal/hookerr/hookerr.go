@@ -0,0 +1,65 @@
+// Package hookerr contains helpers for attributing errors to the hooks that
+// returned them.
+package hookerr
+
+import (
+	"reflect"
+	"runtime"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/ipfs/go-datastore"
+)
+
+// Wrap returns `err`, the error returned by the hook function `f` of kind
+// `hook` when called for `c` and `key`, as a *call.HookError. If `err` is nil,
+// is `prev`, the error the hook was passed, or is already a *call.HookError
+// (e.g. from a hook that calls other hooks) it is returned as is.
+func Wrap(c *call.Call, hook string, f interface{}, key datastore.Key, prev, err error) error {
+	if err == nil || same(err, prev) {
+		return err
+	}
+	if _, ok := err.(*call.HookError); ok {
+		return err
+	}
+	return &call.HookError{
+		Op:   c.Op(),
+		Hook: hook,
+		Func: funcName(c, f),
+		Key:  key,
+		Err:  err,
+	}
+}
+
+// makeFuncStub is the name of the functions created by reflect.MakeFunc.
+const makeFuncStub = "reflect.makeFuncStub"
+
+type funcKey struct{}
+
+// SetFunc records `name` as the name of the hook function that is about to be
+// called for `c` by a wrapper created with reflect.MakeFunc (e.g. to recover
+// panics), so that errors returned through the wrapper are attributed to the
+// wrapped function rather than to reflect.makeFuncStub.
+func SetFunc(c *call.Call, name string) {
+	c.Set(funcKey{}, name)
+}
+
+// funcName returns the name of the hook function `f` called for `c`.
+func funcName(c *call.Call, f interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	if name == makeFuncStub {
+		if n, ok := c.Value(funcKey{}).(string); ok {
+			return n
+		}
+	}
+	return name
+}
+
+func same(a, b error) bool {
+	if b == nil || reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	if !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
@@ -0,0 +1,118 @@
+// Package recovery contains helpers for recovering from panics in the hooks of
+// hook options structs, i.e. structs whose exported fields are lists of hooks.
+package recovery
+
+import (
+	"reflect"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/internal/hookerr"
+)
+
+var (
+	callType  = reflect.TypeOf((*call.Call)(nil))
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Hooks replaces every hook in the options struct pointed to by `o` with one
+// that recovers if the hook panics. A recovered panic is passed to `onPanic`
+// (if not nil) and the hook returns zero values, with the *call.PanicError as
+// it's error if it returns one. Hook lists named in `skip` are left as is.
+func Hooks(o interface{}, onPanic func(*call.PanicError), skip ...string) {
+	v := reflect.ValueOf(o).Elem()
+	t := v.Type()
+Fields:
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		if field.Type.Kind() != reflect.Slice || field.Type.Elem().Kind() != reflect.Func {
+			continue
+		}
+		for _, name := range skip {
+			if field.Name == name {
+				continue Fields
+			}
+		}
+		hooks := v.Field(i)
+		recovering := reflect.MakeSlice(field.Type, hooks.Len(), hooks.Len())
+		for j := 0; j < hooks.Len(); j++ {
+			recovering.Index(j).Set(recoverHook(field.Name, hooks.Index(j), onPanic))
+		}
+		hooks.Set(recovering)
+	}
+}
+
+func recoverHook(name string, f reflect.Value, onPanic func(*call.PanicError)) reflect.Value {
+	t := f.Type()
+	fn := runtime.FuncForPC(f.Pointer()).Name()
+	return reflect.MakeFunc(t, func(args []reflect.Value) (results []reflect.Value) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			perr := &call.PanicError{Hook: name, Func: fn, Value: v, Stack: debug.Stack()}
+			if len(args) > 0 && args[0].Type() == callType && !args[0].IsNil() {
+				perr.Op = args[0].Interface().(*call.Call).Op()
+			}
+			if onPanic != nil {
+				onPanic(perr)
+			}
+			results = make([]reflect.Value, t.NumOut())
+			for i := range results {
+				results[i] = reflect.Zero(t.Out(i))
+			}
+			if last := t.NumOut() - 1; last >= 0 && t.Out(last) == errorType {
+				results[last] = reflect.ValueOf(error(perr)).Convert(errorType)
+			}
+		}()
+		if len(args) > 0 && args[0].Type() == callType && !args[0].IsNil() {
+			hookerr.SetFunc(args[0].Interface().(*call.Call), fn)
+		}
+		return f.Call(args)
+	})
+}
+
+// Interceptors returns the interceptors `is` wrapped so that they recover if
+// they panic. A recovered panic is passed to `onPanic` (if not nil) and the
+// interceptor returns the *call.PanicError as the error of the result. Panics
+// that occur in `next`, i.e. in the hooks or the wrapped datastore, are not
+// recovered by the interceptor.
+func Interceptors(is []call.Interceptor, onPanic func(*call.PanicError)) []call.Interceptor {
+	recovering := make([]call.Interceptor, len(is))
+	for j, i := range is {
+		i := i
+		fn := runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
+		recovering[j] = func(op call.Op, next call.Handler) (res call.Result) {
+			var nextPanicked bool
+			defer func() {
+				if nextPanicked {
+					return // let the panic continue
+				}
+				v := recover()
+				if v == nil {
+					return
+				}
+				perr := &call.PanicError{Hook: "Interceptor", Func: fn, Value: v, Stack: debug.Stack()}
+				if op.Call != nil {
+					perr.Op = op.Call.Op()
+				}
+				if onPanic != nil {
+					onPanic(perr)
+				}
+				res = call.Result{Err: perr}
+			}()
+			return i(op, func(op call.Op) call.Result {
+				nextPanicked = true
+				res := next(op)
+				nextPanicked = false
+				return res
+			})
+		}
+	}
+	return recovering
+}
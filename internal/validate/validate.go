@@ -0,0 +1,90 @@
+// Package validate contains helpers for validating hook options structs, i.e.
+// structs whose exported fields are lists of hooks.
+package validate
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Func validates the options struct pointed to by `o` once all options have
+// been applied.
+type Func func(o interface{}) error
+
+// Check returns an error if any of the hooks in the options struct pointed to
+// by `o` are nil or any of the `validators` fail. Errors are prefixed with
+// `name`, e.g. "batch options".
+func Check(name string, o interface{}, validators []Func) error {
+	if err := NoNilHooks(o); err != nil {
+		return fmt.Errorf("%s invalid: %s", name, err)
+	}
+	for _, f := range validators {
+		if err := f(o); err != nil {
+			return fmt.Errorf("%s invalid: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Exclusive calls `apply` to configure hooks in the options struct pointed to
+// by `o` and returns a Func that fails if any other hooks are configured for
+// the same hook lists as the hooks it added.
+func Exclusive(o interface{}, apply func() error) (Func, error) {
+	prev := Counts(o)
+	if err := apply(); err != nil {
+		return nil, err
+	}
+	added := map[string]int{}
+	for name, n := range Counts(o) {
+		if n > prev[name] {
+			added[name] = n - prev[name]
+		}
+	}
+	return func(o interface{}) error {
+		for name, n := range Counts(o) {
+			if added[name] > 0 && n > added[name] {
+				return fmt.Errorf("conflicting exclusive %s hook", name)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// Counts returns the number of hooks configured for each exported hook list
+// field of the options struct pointed to by `o`.
+func Counts(o interface{}) map[string]int {
+	counts := map[string]int{}
+	eachHookList(o, func(name string, hooks reflect.Value) {
+		counts[name] = hooks.Len()
+	})
+	return counts
+}
+
+// NoNilHooks returns an error if any of the hooks in the options struct
+// pointed to by `o` are nil.
+func NoNilHooks(o interface{}) error {
+	var err error
+	eachHookList(o, func(name string, hooks reflect.Value) {
+		for i := 0; i < hooks.Len() && err == nil; i++ {
+			if hooks.Index(i).IsNil() {
+				err = fmt.Errorf("nil %s hook", name)
+			}
+		}
+	})
+	return err
+}
+
+func eachHookList(o interface{}, f func(string, reflect.Value)) {
+	v := reflect.ValueOf(o).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		if field.Type.Kind() != reflect.Slice || field.Type.Elem().Kind() != reflect.Func {
+			continue
+		}
+		f(field.Name, v.Field(i))
+	}
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the buckets of the
+// latency histograms of a Memory sink.
+var DefaultLatencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// DefaultSizeBuckets are the upper bounds, in bytes, of the buckets of the key
+// and value size histograms of a Memory sink.
+var DefaultSizeBuckets = []float64{16, 64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20}
+
+// Histogram counts observed values in buckets.
+type Histogram struct {
+	// Bounds are the inclusive upper bounds of the buckets, in increasing
+	// order.
+	Bounds []float64
+	// Counts are the number of values in each bucket, i.e. greater than the
+	// previous bound and not greater than it's own. The last count is of the
+	// values greater than all bounds.
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+func newHistogram(bounds []float64) Histogram {
+	return Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *Histogram) observe(v float64) {
+	h.Counts[sort.SearchFloat64s(h.Bounds, v)]++
+	h.Count++
+	h.Sum += v
+}
+
+func (h Histogram) clone() Histogram {
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+// Series identifies the observations aggregated together.
+type Series struct {
+	Op     string
+	Prefix string
+}
+
+// Stats are the aggregated observations of a series.
+type Stats struct {
+	Count  uint64
+	Errors uint64
+	// Latency is the histogram of the durations of operations that have them,
+	// in seconds.
+	Latency Histogram
+	// KeySize and ValueSize are the histograms of the sizes of the keys and
+	// values of operations that have them, in bytes.
+	KeySize   Histogram
+	ValueSize Histogram
+}
+
+// Memory is a sink that aggregates observations in memory, e.g. for tests or
+// to be exported to Prometheus by a prometheus.Collector.
+type Memory struct {
+	latencyBuckets []float64
+	sizeBuckets    []float64
+
+	mu    sync.Mutex
+	stats map[Series]*Stats
+}
+
+// NewMemory creates a new in memory sink, using the default buckets.
+func NewMemory() *Memory {
+	return &Memory{
+		latencyBuckets: append([]float64(nil), DefaultLatencyBuckets...),
+		sizeBuckets:    append([]float64(nil), DefaultSizeBuckets...),
+		stats:          map[Series]*Stats{},
+	}
+}
+
+// Observe aggregates an observation.
+func (m *Memory) Observe(obs Observation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series := Series{Op: obs.Op, Prefix: obs.Prefix}
+	s, ok := m.stats[series]
+	if !ok {
+		s = m.newStats()
+		m.stats[series] = s
+	}
+	s.Count++
+	if obs.Failed() {
+		s.Errors++
+	}
+	if obs.Duration >= 0 {
+		s.Latency.observe(obs.Duration.Seconds())
+	}
+	if obs.KeySize >= 0 {
+		s.KeySize.observe(float64(obs.KeySize))
+	}
+	if obs.ValueSize >= 0 {
+		s.ValueSize.observe(float64(obs.ValueSize))
+	}
+}
+
+// Stats returns the aggregated observations of the operation named `op` with
+// the key prefix `prefix`, which is empty unless configured WithPrefixDepth.
+func (m *Memory) Stats(op, prefix string) Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.stats[Series{Op: op, Prefix: prefix}]
+	if !ok {
+		s = m.newStats()
+	}
+	return s.clone()
+}
+
+// Snapshot returns the aggregated observations of every series.
+func (m *Memory) Snapshot() map[Series]Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap := make(map[Series]Stats, len(m.stats))
+	for series, s := range m.stats {
+		snap[series] = s.clone()
+	}
+	return snap
+}
+
+// Reset discards all aggregated observations.
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats = map[Series]*Stats{}
+}
+
+func (m *Memory) newStats() *Stats {
+	return &Stats{
+		Latency:   newHistogram(m.latencyBuckets),
+		KeySize:   newHistogram(m.sizeBuckets),
+		ValueSize: newHistogram(m.sizeBuckets),
+	}
+}
+
+func (s *Stats) clone() Stats {
+	return Stats{
+		Count:     s.Count,
+		Errors:    s.Errors,
+		Latency:   s.Latency.clone(),
+		KeySize:   s.KeySize.clone(),
+		ValueSize: s.ValueSize.clone(),
+	}
+}
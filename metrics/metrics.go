@@ -0,0 +1,164 @@
+// Package metrics measures the operations of hooked datastores, batches and
+// query results, passing the measurements to a pluggable Sink.
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	hook "github.com/alanshaw/ipfs-hookds"
+	"github.com/alanshaw/ipfs-hookds/batch"
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/query/results"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Observation is the measurement of a single completed operation.
+type Observation struct {
+	// Op is the name of the operation, e.g. "Datastore.Put" or "Batch.Commit",
+	// or "Results.Entry" for an entry read from query results by Results.Next,
+	// Results.NextSync or Results.Rest.
+	Op string
+	// Prefix is the key prefix the operation is split by, empty unless
+	// configured WithPrefixDepth.
+	Prefix string
+	// Duration is the time taken by the operation, including it's hooks. For
+	// Results.Next it is the time taken to return the channel and it is -1 for
+	// Results.Entry.
+	Duration time.Duration
+	// Err is the error returned by the operation, or of the result read by
+	// Results.NextSync.
+	Err error
+	// KeySize is the size of the key of the operation or entry, or -1 if there
+	// is no key, e.g. for queries.
+	KeySize int
+	// ValueSize is the size of the value put, got or read, or -1 if there is no
+	// value.
+	ValueSize int
+}
+
+// Failed returns true if the operation failed. datastore.ErrNotFound, including
+// when it is returned by a hook (e.g. a negative lookup), is not a failure.
+func (o Observation) Failed() bool {
+	return o.Err != nil && !errors.Is(o.Err, datastore.ErrNotFound)
+}
+
+// Sink receives observations, e.g. to aggregate or export them. It must be
+// safe for concurrent use.
+type Sink interface {
+	Observe(Observation)
+}
+
+// Metrics measures operations and passes the observations to a sink.
+type Metrics struct {
+	sink    Sink
+	options Options
+}
+
+// New creates metrics that pass their observations to `sink`.
+func New(sink Sink, options ...Option) (*Metrics, error) {
+	opts := Options{}
+	if err := opts.Apply(options...); err != nil {
+		return nil, err
+	}
+	return &Metrics{sink: sink, options: opts}, nil
+}
+
+// Hooks returns the option that configures a hooked datastore to be measured,
+// including the batches, transactions and query results it creates.
+func (m *Metrics) Hooks() hook.Option {
+	return func(o *hook.Options) error {
+		return o.Apply(hook.WithInterceptor(m.intercept), hook.WithQueryResults(results.WithEntry(m.entry)))
+	}
+}
+
+// BatchHooks returns the option that configures a hooked batch to be measured.
+func (m *Metrics) BatchHooks() batch.Option {
+	return batch.WithInterceptor(m.intercept)
+}
+
+// ResultsHooks returns the option that configures hooked query results to be
+// measured.
+func (m *Metrics) ResultsHooks() results.Option {
+	return func(o *results.Options) error {
+		return o.Apply(results.WithInterceptor(m.intercept), results.WithEntry(m.entry))
+	}
+}
+
+// intercept is the interceptor that measures operations.
+func (m *Metrics) intercept(op call.Op, next call.Handler) call.Result {
+	start := time.Now()
+	res := next(op)
+	obs := Observation{
+		Op:        op.Call.Op(),
+		Duration:  time.Since(start),
+		Err:       res.Err,
+		KeySize:   -1,
+		ValueSize: -1,
+	}
+
+	key := op.Key
+	if key.String() != "" && key.String() != "/" {
+		obs.KeySize = len(key.String())
+	}
+	switch obs.Op {
+	case "Datastore.Query", "Txn.Query":
+		// split by the prefix of the query, which is not a key
+		key = datastore.NewKey(op.Query.Prefix)
+	case "Results.NextSync":
+		// the sizes of the entry are measured by the entry hook
+		obs.Err = res.QueryResult.Error
+		if res.OK && res.QueryResult.Error == nil {
+			key = datastore.RawKey(res.QueryResult.Key)
+		}
+	case "Datastore.Get", "Txn.Get":
+		if res.Err == nil {
+			obs.ValueSize = len(res.Value)
+		}
+	case "Datastore.GetSize", "Txn.GetSize":
+		if res.Err == nil {
+			obs.ValueSize = res.Size
+		}
+	}
+	if op.Value != nil {
+		obs.ValueSize = len(op.Value)
+	}
+	obs.Prefix = m.prefix(key)
+
+	m.sink.Observe(obs)
+	return res
+}
+
+// entry is the results entry hook that measures the entries read from query
+// results, however they are read.
+func (m *Metrics) entry(c *call.Call, e query.Entry) (query.Entry, bool, error) {
+	obs := Observation{
+		Op:        "Results.Entry",
+		Prefix:    m.prefix(datastore.RawKey(e.Key)),
+		Duration:  -1,
+		KeySize:   len(e.Key),
+		ValueSize: -1,
+	}
+	if e.Value != nil {
+		obs.ValueSize = len(e.Value)
+	}
+	m.sink.Observe(obs)
+	return e, true, nil
+}
+
+// prefix returns the first namespaces of `key` as configured WithPrefixDepth,
+// or the empty string for operations without a key.
+func (m *Metrics) prefix(key datastore.Key) string {
+	if m.options.PrefixDepth == 0 || key.String() == "" {
+		return ""
+	}
+	ns := key.Namespaces()
+	if key.String() == "/" {
+		ns = nil
+	}
+	if len(ns) > m.options.PrefixDepth {
+		ns = ns[:m.options.PrefixDepth]
+	}
+	return datastore.KeyWithNamespaces(ns).String()
+}
@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	hook "github.com/alanshaw/ipfs-hookds"
+	"github.com/alanshaw/ipfs-hookds/batch"
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/query/results"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+func TestMetrics(t *testing.T) {
+	sink := NewMemory()
+	m, err := New(sink, WithPrefixDepth(1))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hds, err := hook.NewBatching(datastore.NewMapDatastore(), m.Hooks())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hds.Put(datastore.NewKey("/blocks/1"), []byte("test"))
+	hds.Put(datastore.NewKey("/blocks/2"), make([]byte, 100))
+	hds.Put(datastore.NewKey("/pins/1"), []byte("test"))
+	hds.Get(datastore.NewKey("/blocks/1"))
+	hds.Get(datastore.NewKey("/blocks/3"))
+
+	s := sink.Stats("Datastore.Put", "/blocks")
+	if s.Count != 2 || s.Errors != 0 || s.Latency.Count != 2 {
+		t.Fatal("incorrect put stats", s)
+	}
+	if s.ValueSize.Count != 2 || s.ValueSize.Sum != 104 || s.ValueSize.Counts[0] != 1 || s.ValueSize.Counts[2] != 1 {
+		t.Fatal("incorrect put value sizes", s.ValueSize)
+	}
+	if s.KeySize.Sum != 18 {
+		t.Fatal("incorrect put key sizes", s.KeySize)
+	}
+	if s := sink.Stats("Datastore.Put", "/pins"); s.Count != 1 {
+		t.Fatal("incorrect put stats", s)
+	}
+
+	// not found is not an error
+	s = sink.Stats("Datastore.Get", "/blocks")
+	if s.Count != 2 || s.Errors != 0 || s.ValueSize.Count != 1 {
+		t.Fatal("incorrect get stats", s)
+	}
+
+	bch, err := hds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	bch.Put(datastore.NewKey("/blocks/4"), []byte("test"))
+	bch.Commit()
+
+	if s := sink.Stats("Batch.Put", "/blocks"); s.Count != 1 {
+		t.Fatal("incorrect batch put stats", s)
+	}
+	if s := sink.Stats("Batch.Commit", ""); s.Count != 1 || s.KeySize.Count != 0 {
+		t.Fatal("incorrect batch commit stats", s)
+	}
+
+	res, err := hds.Query(query.Query{Prefix: "/pins"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	for {
+		if _, ok := res.NextSync(); !ok {
+			break
+		}
+	}
+	res.Close()
+
+	// the query prefix is not a key
+	if s := sink.Stats("Datastore.Query", "/pins"); s.Count != 1 || s.KeySize.Count != 0 {
+		t.Fatal("incorrect query stats", s)
+	}
+	if s := sink.Stats("Results.NextSync", "/pins"); s.Count != 1 {
+		t.Fatal("incorrect next sync stats", s)
+	}
+	if s := sink.Stats("Results.Entry", "/pins"); s.Count != 1 || s.ValueSize.Sum != 4 || s.KeySize.Sum != 7 || s.Latency.Count != 0 {
+		t.Fatal("incorrect entry stats", s)
+	}
+}
+
+func TestMetricsResultsEntries(t *testing.T) {
+	sink := NewMemory()
+	m, err := New(sink)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hds, err := hook.NewDatastore(datastore.NewMapDatastore(), m.Hooks())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hds.Put(datastore.NewKey("/1"), []byte("test"))
+	hds.Put(datastore.NewKey("/2"), make([]byte, 100))
+
+	// entries are measured however they are read
+	res, err := hds.Query(query.Query{})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	for range res.Next() {
+	}
+	res.Close()
+
+	res, err = hds.Query(query.Query{})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if _, err = res.Rest(); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if s := sink.Stats("Results.Entry", ""); s.Count != 4 || s.ValueSize.Sum != 208 || s.KeySize.Sum != 8 {
+		t.Fatal("incorrect entry stats", s)
+	}
+}
+
+func TestMetricsNotFoundFromHook(t *testing.T) {
+	sink := NewMemory()
+	m, err := New(sink)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	// negative lookup
+	onBeforeGet := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
+		return k, datastore.ErrNotFound
+	}
+
+	hds, err := hook.NewDatastore(datastore.NewMapDatastore(), m.Hooks(), hook.WithBeforeGet(onBeforeGet))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	_, err = hds.Get(datastore.NewKey("test"))
+	if !errors.Is(err, datastore.ErrNotFound) {
+		t.Fatal("expected not found error", err)
+	}
+
+	if s := sink.Stats("Datastore.Get", ""); s.Count != 1 || s.Errors != 0 {
+		t.Fatal("expected not found not to be counted as an error", s)
+	}
+}
+
+func TestMetricsStandalone(t *testing.T) {
+	sink := NewMemory()
+	m, err := New(sink)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	ds := datastore.NewMapDatastore()
+	bch, err := ds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	hbh, err := batch.NewBatch(bch, m.BatchHooks())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	hbh.Put(datastore.NewKey("test"), []byte("test"))
+	hbh.Commit()
+
+	res, err := ds.Query(query.Query{})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	hres, err := results.NewResults(res, m.ResultsHooks())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	hres.Rest()
+
+	snap := sink.Snapshot()
+	for _, op := range []string{"Batch.Put", "Batch.Commit", "Results.Rest"} {
+		if snap[Series{Op: op}].Count != 1 {
+			t.Fatal("expected operation to be observed", op, snap)
+		}
+	}
+
+	sink.Reset()
+	if len(sink.Snapshot()) != 0 {
+		t.Fatal("expected no observations after reset")
+	}
+}
+
+func TestInvalidPrefixDepth(t *testing.T) {
+	_, err := New(NewMemory(), WithPrefixDepth(-1))
+	if err == nil {
+		t.Fatal("expected invalid prefix depth error")
+	}
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import "fmt"
+
+// Options are metrics options.
+type Options struct {
+	// PrefixDepth is the number of leading key namespaces that observations
+	// are split by. Zero means they are not split by key prefix.
+	PrefixDepth int
+}
+
+// Option is the metrics option type.
+type Option func(*Options) error
+
+// Apply applies the given options to this Option.
+func (o *Options) Apply(opts ...Option) error {
+	for i, opt := range opts {
+		if err := opt(o); err != nil {
+			return fmt.Errorf("metrics option %d failed: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// WithPrefixDepth configures observations to be split by the first `n`
+// namespaces of the key of the operation, e.g. "/blocks" for the key
+// "/blocks/CIQ" and n = 1. Queries are split by their prefix.
+// Defaults to not splitting by key prefix.
+func WithPrefixDepth(n int) Option {
+	return func(o *Options) error {
+		if n < 0 {
+			return fmt.Errorf("invalid prefix depth %d", n)
+		}
+		o.PrefixDepth = n
+		return nil
+	}
+}
@@ -0,0 +1,77 @@
+// Package prometheus exports the observations aggregated by a metrics.Memory
+// sink to Prometheus.
+package prometheus
+
+import (
+	"github.com/alanshaw/ipfs-hookds/metrics"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector for the observations aggregated by a
+// metrics.Memory sink. The following metrics are collected, labelled by "op"
+// and "prefix":
+//
+//	<namespace>_operations_total
+//	<namespace>_errors_total
+//	<namespace>_operation_duration_seconds (histogram)
+//	<namespace>_key_size_bytes (histogram)
+//	<namespace>_value_size_bytes (histogram)
+type Collector struct {
+	m *metrics.Memory
+
+	operations *prom.Desc
+	errors     *prom.Desc
+	latency    *prom.Desc
+	keySize    *prom.Desc
+	valueSize  *prom.Desc
+}
+
+// NewCollector creates a collector for the observations aggregated by `m`,
+// with metric names prefixed by `namespace`, e.g. "datastore". It can be
+// registered with any Prometheus registry.
+func NewCollector(m *metrics.Memory, namespace string) *Collector {
+	labels := []string{"op", "prefix"}
+	desc := func(name, help string) *prom.Desc {
+		return prom.NewDesc(prom.BuildFQName(namespace, "", name), help, labels, nil)
+	}
+	return &Collector{
+		m:          m,
+		operations: desc("operations_total", "Number of datastore operations."),
+		errors:     desc("errors_total", "Number of failed datastore operations."),
+		latency:    desc("operation_duration_seconds", "Duration of datastore operations."),
+		keySize:    desc("key_size_bytes", "Size of the keys of datastore operations."),
+		valueSize:  desc("value_size_bytes", "Size of the values of datastore operations."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.operations
+	ch <- c.errors
+	ch <- c.latency
+	ch <- c.keySize
+	ch <- c.valueSize
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	for series, s := range c.m.Snapshot() {
+		ch <- prom.MustNewConstMetric(c.operations, prom.CounterValue, float64(s.Count), series.Op, series.Prefix)
+		ch <- prom.MustNewConstMetric(c.errors, prom.CounterValue, float64(s.Errors), series.Op, series.Prefix)
+		ch <- histogram(c.latency, series, s.Latency)
+		ch <- histogram(c.keySize, series, s.KeySize)
+		ch <- histogram(c.valueSize, series, s.ValueSize)
+	}
+}
+
+// histogram converts a histogram to a constant Prometheus histogram, whose
+// bucket counts are cumulative.
+func histogram(desc *prom.Desc, series metrics.Series, h metrics.Histogram) prom.Metric {
+	buckets := make(map[float64]uint64, len(h.Bounds))
+	var n uint64
+	for i, bound := range h.Bounds {
+		n += h.Counts[i]
+		buckets[bound] = n
+	}
+	return prom.MustNewConstHistogram(desc, h.Count, h.Sum, buckets, series.Op, series.Prefix)
+}
@@ -0,0 +1,58 @@
+package prometheus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanshaw/ipfs-hookds/metrics"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	sink := metrics.NewMemory()
+	sink.Observe(metrics.Observation{Op: "Datastore.Put", Prefix: "/blocks", Duration: time.Millisecond, KeySize: 9, ValueSize: 100})
+	sink.Observe(metrics.Observation{Op: "Datastore.Put", Prefix: "/blocks", Duration: time.Second, Err: errors.New("test"), KeySize: 9, ValueSize: 10})
+
+	reg := prom.NewPedanticRegistry()
+	err := reg.Register(NewCollector(sink, "datastore"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	expected := `
+# HELP datastore_errors_total Number of failed datastore operations.
+# TYPE datastore_errors_total counter
+datastore_errors_total{op="Datastore.Put",prefix="/blocks"} 1
+# HELP datastore_operations_total Number of datastore operations.
+# TYPE datastore_operations_total counter
+datastore_operations_total{op="Datastore.Put",prefix="/blocks"} 2
+`
+	err = testutil.GatherAndCompare(reg, strings.NewReader(expected), "datastore_operations_total", "datastore_errors_total")
+	if err != nil {
+		t.Fatal("unexpected metrics", err)
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "datastore_operation_duration_seconds" {
+			continue
+		}
+		h := mf.GetMetric()[0].GetHistogram()
+		if h.GetSampleCount() != 2 || h.GetSampleSum() != 1.001 {
+			t.Fatal("incorrect latency histogram", h)
+		}
+		for _, b := range h.GetBucket() {
+			if b.GetUpperBound() == 0.001 && b.GetCumulativeCount() != 1 {
+				t.Fatal("incorrect latency bucket", b)
+			}
+		}
+		return
+	}
+	t.Fatal("expected latency histogram")
+}
@@ -2,61 +2,208 @@ package hook
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/alanshaw/ipfs-hookds/batch"
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/internal/recovery"
+	"github.com/alanshaw/ipfs-hookds/internal/validate"
+	"github.com/alanshaw/ipfs-hookds/query/results"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
 )
 
 // BeforeGetFunc is a handler for the before Get hook
-type BeforeGetFunc func(datastore.Key) datastore.Key
+// Returning an error aborts the Get and the error is passed to the after hooks.
+// Returning a ShortCircuit error skips the wrapped datastore.
+type BeforeGetFunc func(*call.Call, datastore.Key) (datastore.Key, error)
 
 // AfterGetFunc is a handler for the after Get hook
-type AfterGetFunc func(datastore.Key, []byte, error) ([]byte, error)
+type AfterGetFunc func(*call.Call, datastore.Key, []byte, error) ([]byte, error)
 
 // BeforePutFunc is a handler for the before Put hook
-type BeforePutFunc func(datastore.Key, []byte) (datastore.Key, []byte)
+// Returning an error aborts the Put and the error is passed to the after hooks.
+type BeforePutFunc func(*call.Call, datastore.Key, []byte) (datastore.Key, []byte, error)
 
 // AfterPutFunc is a handler for the after Put hook
-type AfterPutFunc func(datastore.Key, []byte, error) error
+type AfterPutFunc func(*call.Call, datastore.Key, []byte, error) error
 
 // BeforeDeleteFunc is a handler for the before Delete hook
-type BeforeDeleteFunc func(datastore.Key) datastore.Key
+// Returning an error aborts the Delete and the error is passed to the after hooks.
+type BeforeDeleteFunc func(*call.Call, datastore.Key) (datastore.Key, error)
 
 // AfterDeleteFunc is a handler for the after Delete hook
-type AfterDeleteFunc func(datastore.Key, error) error
+type AfterDeleteFunc func(*call.Call, datastore.Key, error) error
 
 // BeforeBatchFunc is a handler for the before Batch hook
-type BeforeBatchFunc func()
+type BeforeBatchFunc func(*call.Call)
 
 // AfterBatchFunc is a handler for the after Batch hook
-type AfterBatchFunc func(datastore.Batch, error) (datastore.Batch, error)
+type AfterBatchFunc func(*call.Call, datastore.Batch, error) (datastore.Batch, error)
 
 // BeforeHasFunc is a handler for the before Has hook
-type BeforeHasFunc func(datastore.Key) datastore.Key
+// Returning an error aborts the Has and the error is passed to the after hooks.
+// Returning a ShortCircuit error skips the wrapped datastore.
+type BeforeHasFunc func(*call.Call, datastore.Key) (datastore.Key, error)
 
 // AfterHasFunc is a handler for the after Has hook
-type AfterHasFunc func(datastore.Key, bool, error) (bool, error)
+type AfterHasFunc func(*call.Call, datastore.Key, bool, error) (bool, error)
 
 // BeforeQueryFunc is a handler for the before Query hook
-type BeforeQueryFunc func(query.Query) query.Query
+// Returning an error aborts the Query and the error is passed to the after hooks.
+type BeforeQueryFunc func(*call.Call, query.Query) (query.Query, error)
 
 // AfterQueryFunc is a handler for the after Query hook
-type AfterQueryFunc func(query.Query, query.Results, error) (query.Results, error)
+type AfterQueryFunc func(*call.Call, query.Query, query.Results, error) (query.Results, error)
 
-// Options are hook datastore options.
+// BeforeGetSizeFunc is a handler for the before GetSize hook
+// Returning an error aborts the GetSize and the error is passed to the after hooks.
+type BeforeGetSizeFunc func(*call.Call, datastore.Key) (datastore.Key, error)
+
+// AfterGetSizeFunc is a handler for the after GetSize hook
+type AfterGetSizeFunc func(*call.Call, datastore.Key, int, error) (int, error)
+
+// BeforeSyncFunc is a handler for the before Sync hook
+// Returning an error aborts the Sync and the error is passed to the after hooks.
+type BeforeSyncFunc func(*call.Call, datastore.Key) (datastore.Key, error)
+
+// AfterSyncFunc is a handler for the after Sync hook
+type AfterSyncFunc func(*call.Call, datastore.Key, error) error
+
+// BeforeCloseFunc is a handler for the before Close hook
+// Returning an error aborts the Close and the error is passed to the after hooks.
+type BeforeCloseFunc func(*call.Call) error
+
+// AfterCloseFunc is a handler for the after Close hook
+type AfterCloseFunc func(*call.Call, error) error
+
+// BeforeCheckFunc is a handler for the before Check hook
+// Returning an error aborts the Check and the error is passed to the after hooks.
+type BeforeCheckFunc func(*call.Call) error
+
+// AfterCheckFunc is a handler for the after Check hook
+type AfterCheckFunc func(*call.Call, error) error
+
+// BeforeScrubFunc is a handler for the before Scrub hook
+// Returning an error aborts the Scrub and the error is passed to the after hooks.
+type BeforeScrubFunc func(*call.Call) error
+
+// AfterScrubFunc is a handler for the after Scrub hook
+type AfterScrubFunc func(*call.Call, error) error
+
+// BeforeCollectGarbageFunc is a handler for the before CollectGarbage hook
+// Returning an error aborts the CollectGarbage and the error is passed to the after hooks.
+type BeforeCollectGarbageFunc func(*call.Call) error
+
+// AfterCollectGarbageFunc is a handler for the after CollectGarbage hook
+type AfterCollectGarbageFunc func(*call.Call, error) error
+
+// BeforeDiskUsageFunc is a handler for the before DiskUsage hook
+// Returning an error aborts the DiskUsage and the error is passed to the after hooks.
+type BeforeDiskUsageFunc func(*call.Call) error
+
+// AfterDiskUsageFunc is a handler for the after DiskUsage hook
+type AfterDiskUsageFunc func(*call.Call, uint64, error) (uint64, error)
+
+// BeforePutWithTTLFunc is a handler for the before PutWithTTL hook
+// Returning an error aborts the PutWithTTL and the error is passed to the after hooks.
+type BeforePutWithTTLFunc func(*call.Call, datastore.Key, []byte, time.Duration) (datastore.Key, []byte, time.Duration, error)
+
+// AfterPutWithTTLFunc is a handler for the after PutWithTTL hook
+type AfterPutWithTTLFunc func(*call.Call, datastore.Key, []byte, time.Duration, error) error
+
+// BeforeSetTTLFunc is a handler for the before SetTTL hook
+// Returning an error aborts the SetTTL and the error is passed to the after hooks.
+type BeforeSetTTLFunc func(*call.Call, datastore.Key, time.Duration) (datastore.Key, time.Duration, error)
+
+// AfterSetTTLFunc is a handler for the after SetTTL hook
+type AfterSetTTLFunc func(*call.Call, datastore.Key, time.Duration, error) error
+
+// BeforeGetExpirationFunc is a handler for the before GetExpiration hook
+// Returning an error aborts the GetExpiration and the error is passed to the after hooks.
+type BeforeGetExpirationFunc func(*call.Call, datastore.Key) (datastore.Key, error)
+
+// AfterGetExpirationFunc is a handler for the after GetExpiration hook
+type AfterGetExpirationFunc func(*call.Call, datastore.Key, time.Time, error) (time.Time, error)
+
+// BeforeNewTransactionFunc is a handler for the before NewTransaction hook
+// Returning an error aborts the NewTransaction and the error is passed to the after hooks.
+type BeforeNewTransactionFunc func(*call.Call, bool) (bool, error)
+
+// AfterNewTransactionFunc is a handler for the after NewTransaction hook
+type AfterNewTransactionFunc func(*call.Call, bool, datastore.Txn, error) (datastore.Txn, error)
+
+// PanicFunc is a handler for panics recovered from hooks.
+type PanicFunc func(*call.PanicError)
+
+// ValidateFunc validates options once all options have been applied.
+type ValidateFunc func(*Options) error
+
+// Options are hook datastore options. Hooks configured for the same method
+// are called in order, each receiving the output of the previous hook.
 type Options struct {
-	BeforeGet    BeforeGetFunc
-	AfterGet     AfterGetFunc
-	BeforePut    BeforePutFunc
-	AfterPut     AfterPutFunc
-	BeforeDelete BeforeDeleteFunc
-	AfterDelete  AfterDeleteFunc
-	BeforeBatch  BeforeBatchFunc
-	AfterBatch   AfterBatchFunc
-	BeforeHas    BeforeHasFunc
-	AfterHas     AfterHasFunc
-	BeforeQuery  BeforeQueryFunc
-	AfterQuery   AfterQueryFunc
+	BeforeGet            []BeforeGetFunc
+	AfterGet             []AfterGetFunc
+	BeforePut            []BeforePutFunc
+	AfterPut             []AfterPutFunc
+	BeforeDelete         []BeforeDeleteFunc
+	AfterDelete          []AfterDeleteFunc
+	BeforeBatch          []BeforeBatchFunc
+	AfterBatch           []AfterBatchFunc
+	BeforeHas            []BeforeHasFunc
+	AfterHas             []AfterHasFunc
+	BeforeQuery          []BeforeQueryFunc
+	AfterQuery           []AfterQueryFunc
+	BeforeGetSize        []BeforeGetSizeFunc
+	AfterGetSize         []AfterGetSizeFunc
+	BeforeSync           []BeforeSyncFunc
+	AfterSync            []AfterSyncFunc
+	BeforeClose          []BeforeCloseFunc
+	AfterClose           []AfterCloseFunc
+	BeforeCheck          []BeforeCheckFunc
+	AfterCheck           []AfterCheckFunc
+	BeforeScrub          []BeforeScrubFunc
+	AfterScrub           []AfterScrubFunc
+	BeforeCollectGarbage []BeforeCollectGarbageFunc
+	AfterCollectGarbage  []AfterCollectGarbageFunc
+	BeforeDiskUsage      []BeforeDiskUsageFunc
+	AfterDiskUsage       []AfterDiskUsageFunc
+	BeforePutWithTTL     []BeforePutWithTTLFunc
+	AfterPutWithTTL      []AfterPutWithTTLFunc
+	BeforeSetTTL         []BeforeSetTTLFunc
+	AfterSetTTL          []AfterSetTTLFunc
+	BeforeGetExpiration  []BeforeGetExpirationFunc
+	AfterGetExpiration   []AfterGetExpirationFunc
+	BeforeNewTransaction []BeforeNewTransactionFunc
+	AfterNewTransaction  []AfterNewTransactionFunc
+
+	// BatchPropagation causes the Put and Delete hooks to also be called for
+	// Put and Delete on batches created by Batching.Batch.
+	BatchPropagation bool
+
+	// Interceptors are called around every operation of the datastore and
+	// of the batches, transactions and query results it creates.
+	Interceptors []call.Interceptor
+
+	// ResultsOptions are applied to the results of every Query, e.g. results
+	// hooks, a results.Tracker or iteration limits.
+	ResultsOptions []results.Option
+
+	// BatchOptions are applied to every batch created by Batching.Batch,
+	// beneath the hooks propagated WithBatchPropagation, e.g. commit hooks.
+	BatchOptions []batch.Option
+
+	// PanicRecovery causes panics in hooks to be recovered and returned as a
+	// *call.PanicError. OnPanic hooks are called for each recovered panic.
+	PanicRecovery bool
+	OnPanic       []PanicFunc
+
+	validators []validate.Func
+
+	// group configures how these hooks are ordered relative to other groups
+	// and groups are the nested groups configured WithGroup.
+	group  group
+	groups []*Options
 }
 
 // Option is the hook datastore option type.
@@ -72,110 +219,520 @@ func (o *Options) Apply(opts ...Option) error {
 	return nil
 }
 
+// merge appends the hooks and validators of `other` to these options.
+func (o *Options) merge(other *Options) {
+	o.BeforeGet = append(o.BeforeGet, other.BeforeGet...)
+	o.AfterGet = append(o.AfterGet, other.AfterGet...)
+	o.BeforePut = append(o.BeforePut, other.BeforePut...)
+	o.AfterPut = append(o.AfterPut, other.AfterPut...)
+	o.BeforeDelete = append(o.BeforeDelete, other.BeforeDelete...)
+	o.AfterDelete = append(o.AfterDelete, other.AfterDelete...)
+	o.BeforeBatch = append(o.BeforeBatch, other.BeforeBatch...)
+	o.AfterBatch = append(o.AfterBatch, other.AfterBatch...)
+	o.BeforeHas = append(o.BeforeHas, other.BeforeHas...)
+	o.AfterHas = append(o.AfterHas, other.AfterHas...)
+	o.BeforeQuery = append(o.BeforeQuery, other.BeforeQuery...)
+	o.AfterQuery = append(o.AfterQuery, other.AfterQuery...)
+	o.BeforeGetSize = append(o.BeforeGetSize, other.BeforeGetSize...)
+	o.AfterGetSize = append(o.AfterGetSize, other.AfterGetSize...)
+	o.BeforeSync = append(o.BeforeSync, other.BeforeSync...)
+	o.AfterSync = append(o.AfterSync, other.AfterSync...)
+	o.BeforeClose = append(o.BeforeClose, other.BeforeClose...)
+	o.AfterClose = append(o.AfterClose, other.AfterClose...)
+	o.BeforeCheck = append(o.BeforeCheck, other.BeforeCheck...)
+	o.AfterCheck = append(o.AfterCheck, other.AfterCheck...)
+	o.BeforeScrub = append(o.BeforeScrub, other.BeforeScrub...)
+	o.AfterScrub = append(o.AfterScrub, other.AfterScrub...)
+	o.BeforeCollectGarbage = append(o.BeforeCollectGarbage, other.BeforeCollectGarbage...)
+	o.AfterCollectGarbage = append(o.AfterCollectGarbage, other.AfterCollectGarbage...)
+	o.BeforeDiskUsage = append(o.BeforeDiskUsage, other.BeforeDiskUsage...)
+	o.AfterDiskUsage = append(o.AfterDiskUsage, other.AfterDiskUsage...)
+	o.BeforePutWithTTL = append(o.BeforePutWithTTL, other.BeforePutWithTTL...)
+	o.AfterPutWithTTL = append(o.AfterPutWithTTL, other.AfterPutWithTTL...)
+	o.BeforeSetTTL = append(o.BeforeSetTTL, other.BeforeSetTTL...)
+	o.AfterSetTTL = append(o.AfterSetTTL, other.AfterSetTTL...)
+	o.BeforeGetExpiration = append(o.BeforeGetExpiration, other.BeforeGetExpiration...)
+	o.AfterGetExpiration = append(o.AfterGetExpiration, other.AfterGetExpiration...)
+	o.BeforeNewTransaction = append(o.BeforeNewTransaction, other.BeforeNewTransaction...)
+	o.AfterNewTransaction = append(o.AfterNewTransaction, other.AfterNewTransaction...)
+	o.BatchPropagation = o.BatchPropagation || other.BatchPropagation
+	o.Interceptors = append(o.Interceptors, other.Interceptors...)
+	o.ResultsOptions = append(o.ResultsOptions, other.ResultsOptions...)
+	o.BatchOptions = append(o.BatchOptions, other.BatchOptions...)
+	o.PanicRecovery = o.PanicRecovery || other.PanicRecovery
+	o.OnPanic = append(o.OnPanic, other.OnPanic...)
+	o.validators = append(o.validators, other.validators...)
+}
+
+// validate checks that no hooks are nil and calls the configured validators.
+func (o *Options) validate() error {
+	if err := results.Validate(o.ResultsOptions...); err != nil {
+		return fmt.Errorf("hook datastore options invalid: %s", err)
+	}
+	if err := batch.Validate(o.BatchOptions...); err != nil {
+		return fmt.Errorf("hook datastore options invalid: %s", err)
+	}
+	return validate.Check("hook datastore options", o, o.validators)
+}
+
+// recoverPanics replaces the hooks with ones that recover from panics, if
+// configured WithPanicRecovery.
+func (o *Options) recoverPanics() {
+	if !o.PanicRecovery {
+		return
+	}
+	onPanic := func(perr *call.PanicError) {
+		for _, f := range o.OnPanic {
+			f(perr)
+		}
+	}
+	recovery.Hooks(o, onPanic, "Interceptors", "ResultsOptions", "BatchOptions", "OnPanic")
+	o.Interceptors = recovery.Interceptors(o.Interceptors, onPanic)
+}
+
+// WithValidator configures a function that validates the options once all
+// options have been applied, allowing bad combinations to be rejected.
+func WithValidator(f ValidateFunc) Option {
+	return func(o *Options) error {
+		o.validators = append(o.validators, func(o interface{}) error {
+			return f(o.(*Options))
+		})
+		return nil
+	}
+}
+
+// Exclusive configures the hooks added by `opt` to be exclusive. Options are
+// invalid if any other hooks are configured for the same methods.
+func Exclusive(opt Option) Option {
+	return func(o *Options) error {
+		check, err := validate.Exclusive(o, func() error { return opt(o) })
+		if err != nil {
+			return err
+		}
+		o.validators = append(o.validators, check)
+		return nil
+	}
+}
+
 // WithBeforeGet configures a hook that is called _before_ Get.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforeGet(f BeforeGetFunc) Option {
 	return func(o *Options) error {
-		o.BeforeGet = f
+		o.BeforeGet = append(o.BeforeGet, f)
 		return nil
 	}
 }
 
 // WithAfterGet configures a hook that is called _after_ Get.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterGet(f AfterGetFunc) Option {
 	return func(o *Options) error {
-		o.AfterGet = f
+		o.AfterGet = append(o.AfterGet, f)
 		return nil
 	}
 }
 
 // WithBeforePut configures a hook that is called _before_ Put.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforePut(f BeforePutFunc) Option {
 	return func(o *Options) error {
-		o.BeforePut = f
+		o.BeforePut = append(o.BeforePut, f)
 		return nil
 	}
 }
 
 // WithAfterPut configures a hook that is called _after_ Put.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterPut(f AfterPutFunc) Option {
 	return func(o *Options) error {
-		o.AfterPut = f
+		o.AfterPut = append(o.AfterPut, f)
 		return nil
 	}
 }
 
 // WithBeforeDelete configures a hook that is called _before_ Delete.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforeDelete(f BeforeDeleteFunc) Option {
 	return func(o *Options) error {
-		o.BeforeDelete = f
+		o.BeforeDelete = append(o.BeforeDelete, f)
 		return nil
 	}
 }
 
 // WithAfterDelete configures a hook that is called _after_ Delete.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterDelete(f AfterDeleteFunc) Option {
 	return func(o *Options) error {
-		o.AfterDelete = f
+		o.AfterDelete = append(o.AfterDelete, f)
 		return nil
 	}
 }
 
 // WithBeforeBatch configures a hook that is called _before_ Batch.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforeBatch(f BeforeBatchFunc) Option {
 	return func(o *Options) error {
-		o.BeforeBatch = f
+		o.BeforeBatch = append(o.BeforeBatch, f)
 		return nil
 	}
 }
 
 // WithAfterBatch configures a hook that is called _after_ Batch.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterBatch(f AfterBatchFunc) Option {
 	return func(o *Options) error {
-		o.AfterBatch = f
+		o.AfterBatch = append(o.AfterBatch, f)
 		return nil
 	}
 }
 
 // WithBeforeHas configures a hook that is called _before_ Has.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforeHas(f BeforeHasFunc) Option {
 	return func(o *Options) error {
-		o.BeforeHas = f
+		o.BeforeHas = append(o.BeforeHas, f)
 		return nil
 	}
 }
 
 // WithAfterHas configures a hook that is called _after_ Has.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterHas(f AfterHasFunc) Option {
 	return func(o *Options) error {
-		o.AfterHas = f
+		o.AfterHas = append(o.AfterHas, f)
 		return nil
 	}
 }
 
 // WithBeforeQuery configures a hook that is called _before_ Query.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforeQuery(f BeforeQueryFunc) Option {
 	return func(o *Options) error {
-		o.BeforeQuery = f
+		o.BeforeQuery = append(o.BeforeQuery, f)
 		return nil
 	}
 }
 
 // WithAfterQuery configures a hook that is called _after_ Query.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterQuery(f AfterQueryFunc) Option {
 	return func(o *Options) error {
-		o.AfterQuery = f
+		o.AfterQuery = append(o.AfterQuery, f)
+		return nil
+	}
+}
+
+// WithBeforeGetSize configures a hook that is called _before_ GetSize.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeGetSize(f BeforeGetSizeFunc) Option {
+	return func(o *Options) error {
+		o.BeforeGetSize = append(o.BeforeGetSize, f)
+		return nil
+	}
+}
+
+// WithAfterGetSize configures a hook that is called _after_ GetSize.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterGetSize(f AfterGetSizeFunc) Option {
+	return func(o *Options) error {
+		o.AfterGetSize = append(o.AfterGetSize, f)
+		return nil
+	}
+}
+
+// WithBeforeSync configures a hook that is called _before_ Sync.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeSync(f BeforeSyncFunc) Option {
+	return func(o *Options) error {
+		o.BeforeSync = append(o.BeforeSync, f)
+		return nil
+	}
+}
+
+// WithAfterSync configures a hook that is called _after_ Sync.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterSync(f AfterSyncFunc) Option {
+	return func(o *Options) error {
+		o.AfterSync = append(o.AfterSync, f)
+		return nil
+	}
+}
+
+// WithBeforeClose configures a hook that is called _before_ Close.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeClose(f BeforeCloseFunc) Option {
+	return func(o *Options) error {
+		o.BeforeClose = append(o.BeforeClose, f)
+		return nil
+	}
+}
+
+// WithAfterClose configures a hook that is called _after_ Close.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterClose(f AfterCloseFunc) Option {
+	return func(o *Options) error {
+		o.AfterClose = append(o.AfterClose, f)
+		return nil
+	}
+}
+
+// WithBeforeCheck configures a hook that is called _before_ Check.
+// It is only called for datastores created with Wrap that wrap a datastore.CheckedDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeCheck(f BeforeCheckFunc) Option {
+	return func(o *Options) error {
+		o.BeforeCheck = append(o.BeforeCheck, f)
+		return nil
+	}
+}
+
+// WithAfterCheck configures a hook that is called _after_ Check.
+// It is only called for datastores created with Wrap that wrap a datastore.CheckedDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterCheck(f AfterCheckFunc) Option {
+	return func(o *Options) error {
+		o.AfterCheck = append(o.AfterCheck, f)
+		return nil
+	}
+}
+
+// WithBeforeScrub configures a hook that is called _before_ Scrub.
+// It is only called for datastores created with Wrap that wrap a datastore.ScrubbedDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeScrub(f BeforeScrubFunc) Option {
+	return func(o *Options) error {
+		o.BeforeScrub = append(o.BeforeScrub, f)
+		return nil
+	}
+}
+
+// WithAfterScrub configures a hook that is called _after_ Scrub.
+// It is only called for datastores created with Wrap that wrap a datastore.ScrubbedDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterScrub(f AfterScrubFunc) Option {
+	return func(o *Options) error {
+		o.AfterScrub = append(o.AfterScrub, f)
+		return nil
+	}
+}
+
+// WithBeforeCollectGarbage configures a hook that is called _before_ CollectGarbage.
+// It is only called for datastores created with Wrap that wrap a datastore.GCDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeCollectGarbage(f BeforeCollectGarbageFunc) Option {
+	return func(o *Options) error {
+		o.BeforeCollectGarbage = append(o.BeforeCollectGarbage, f)
+		return nil
+	}
+}
+
+// WithAfterCollectGarbage configures a hook that is called _after_ CollectGarbage.
+// It is only called for datastores created with Wrap that wrap a datastore.GCDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterCollectGarbage(f AfterCollectGarbageFunc) Option {
+	return func(o *Options) error {
+		o.AfterCollectGarbage = append(o.AfterCollectGarbage, f)
+		return nil
+	}
+}
+
+// WithBeforeDiskUsage configures a hook that is called _before_ DiskUsage.
+// It is only called for datastores created with Wrap that wrap a datastore.PersistentDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeDiskUsage(f BeforeDiskUsageFunc) Option {
+	return func(o *Options) error {
+		o.BeforeDiskUsage = append(o.BeforeDiskUsage, f)
+		return nil
+	}
+}
+
+// WithAfterDiskUsage configures a hook that is called _after_ DiskUsage.
+// It is only called for datastores created with Wrap that wrap a datastore.PersistentDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterDiskUsage(f AfterDiskUsageFunc) Option {
+	return func(o *Options) error {
+		o.AfterDiskUsage = append(o.AfterDiskUsage, f)
+		return nil
+	}
+}
+
+// WithBeforePutWithTTL configures a hook that is called _before_ PutWithTTL.
+// It is only called for datastores created with Wrap that wrap a datastore.TTLDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforePutWithTTL(f BeforePutWithTTLFunc) Option {
+	return func(o *Options) error {
+		o.BeforePutWithTTL = append(o.BeforePutWithTTL, f)
+		return nil
+	}
+}
+
+// WithAfterPutWithTTL configures a hook that is called _after_ PutWithTTL.
+// It is only called for datastores created with Wrap that wrap a datastore.TTLDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterPutWithTTL(f AfterPutWithTTLFunc) Option {
+	return func(o *Options) error {
+		o.AfterPutWithTTL = append(o.AfterPutWithTTL, f)
+		return nil
+	}
+}
+
+// WithBeforeSetTTL configures a hook that is called _before_ SetTTL.
+// It is only called for datastores created with Wrap that wrap a datastore.TTLDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeSetTTL(f BeforeSetTTLFunc) Option {
+	return func(o *Options) error {
+		o.BeforeSetTTL = append(o.BeforeSetTTL, f)
+		return nil
+	}
+}
+
+// WithAfterSetTTL configures a hook that is called _after_ SetTTL.
+// It is only called for datastores created with Wrap that wrap a datastore.TTLDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterSetTTL(f AfterSetTTLFunc) Option {
+	return func(o *Options) error {
+		o.AfterSetTTL = append(o.AfterSetTTL, f)
+		return nil
+	}
+}
+
+// WithBeforeGetExpiration configures a hook that is called _before_ GetExpiration.
+// It is only called for datastores created with Wrap that wrap a datastore.TTLDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeGetExpiration(f BeforeGetExpirationFunc) Option {
+	return func(o *Options) error {
+		o.BeforeGetExpiration = append(o.BeforeGetExpiration, f)
+		return nil
+	}
+}
+
+// WithAfterGetExpiration configures a hook that is called _after_ GetExpiration.
+// It is only called for datastores created with Wrap that wrap a datastore.TTLDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterGetExpiration(f AfterGetExpirationFunc) Option {
+	return func(o *Options) error {
+		o.AfterGetExpiration = append(o.AfterGetExpiration, f)
+		return nil
+	}
+}
+
+// WithBeforeNewTransaction configures a hook that is called _before_ NewTransaction.
+// It is only called for datastores created with Wrap that wrap a datastore.TxnDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeNewTransaction(f BeforeNewTransactionFunc) Option {
+	return func(o *Options) error {
+		o.BeforeNewTransaction = append(o.BeforeNewTransaction, f)
+		return nil
+	}
+}
+
+// WithAfterNewTransaction configures a hook that is called _after_ NewTransaction.
+// It is only called for datastores created with Wrap that wrap a datastore.TxnDatastore.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterNewTransaction(f AfterNewTransactionFunc) Option {
+	return func(o *Options) error {
+		o.AfterNewTransaction = append(o.AfterNewTransaction, f)
+		return nil
+	}
+}
+
+// WithBatchPropagation configures the Put and Delete hooks to _also_ be called
+// for Put and Delete on batches created by Batching.Batch, so that values are
+// transformed in the same way regardless of the write path. Batches that only
+// write when they are committed return errors of the write from Commit, rather
+// than passing them to the after hooks.
+// Defaults to false.
+func WithBatchPropagation() Option {
+	return func(o *Options) error {
+		o.BatchPropagation = true
+		return nil
+	}
+}
+
+// WithInterceptor configures middleware that is called around every operation,
+// including the before and after hooks.
+// Multiple interceptors are called in the order they were configured, the
+// first being the outermost.
+func WithInterceptor(i call.Interceptor) Option {
+	return func(o *Options) error {
+		o.Interceptors = append(o.Interceptors, i)
+		return nil
+	}
+}
+
+// WithQueryResults configures options that are applied to the results of
+// every Query, including those of transactions, e.g. results hooks, a
+// results.Tracker or default iteration limits such as results.WithMaxEntries.
+// The options are validated when the datastore is created or the hooks are
+// added. Results hooks are recovered from panics if the datastore is
+// configured WithPanicRecovery.
+func WithQueryResults(options ...results.Option) Option {
+	return func(o *Options) error {
+		o.ResultsOptions = append(o.ResultsOptions, options...)
+		return nil
+	}
+}
+
+// WithBatchOptions configures options that are applied to every batch created
+// by Batching.Batch, e.g. commit hooks. The batch hooks are called beneath the
+// Put and Delete hooks propagated WithBatchPropagation, so they see the keys
+// and values that are written to the wrapped batch. The options are validated
+// when the datastore is created or the hooks are added. Batch hooks are
+// recovered from panics if the datastore is configured WithPanicRecovery.
+func WithBatchOptions(options ...batch.Option) Option {
+	return func(o *Options) error {
+		o.BatchOptions = append(o.BatchOptions, options...)
+		return nil
+	}
+}
+
+// WithPanicRecovery causes panics in hooks to be recovered and converted into a
+// *call.PanicError that is returned by the hook, so that it is handled like any
+// other hook error. If not nil, `f` is called for each recovered panic, e.g. to
+// log or count it. Hooks that do not return an error (i.e. BeforeBatch) return
+// normally after a recovered panic. Interceptors are recovered too, the panic
+// being returned as the error of the operation, but panics in the wrapped
+// datastore are not.
+func WithPanicRecovery(f PanicFunc) Option {
+	return func(o *Options) error {
+		o.PanicRecovery = true
+		if f != nil {
+			o.OnPanic = append(o.OnPanic, f)
+		}
 		return nil
 	}
 }
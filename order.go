@@ -0,0 +1,203 @@
+package hook
+
+import (
+	"fmt"
+	"strings"
+)
+
+// group is a set of hooks that is ordered as a unit, i.e. the options of a
+// registration or of a WithGroup option.
+type group struct {
+	name     string
+	priority int
+	before   []string
+	after    []string
+}
+
+// WithGroup configures a named group of hooks. The hooks of a group are called
+// together, in the order they were configured, and the group as a whole can be
+// ordered relative to other groups using WithPriority, WithRunBefore and
+// WithRunAfter. Group names must be unique within a datastore.
+func WithGroup(name string, options ...Option) Option {
+	return func(o *Options) error {
+		if name == "" {
+			return fmt.Errorf("hook group name must not be empty")
+		}
+		g := Options{}
+		g.group.name = name
+		if err := g.Apply(options...); err != nil {
+			return fmt.Errorf("hook group %q: %s", name, err)
+		}
+		o.groups = append(o.groups, &g)
+		return nil
+	}
+}
+
+// WithPriority configures the priority of the hooks being configured, either
+// of a group (when passed to WithGroup) or of all the ungrouped hooks passed to
+// NewDatastore or AddHook. Hooks with a higher priority are called first. The
+// default priority is 0. Named groups with equal priority must be ordered with
+// WithRunBefore or WithRunAfter, otherwise the hooks are invalid. Ungrouped
+// hooks with equal priority are called in the order they were registered.
+func WithPriority(priority int) Option {
+	return func(o *Options) error {
+		o.group.priority = priority
+		return nil
+	}
+}
+
+// WithRunBefore configures the hooks being configured to be called before the
+// hooks of the named groups, regardless of priority.
+func WithRunBefore(names ...string) Option {
+	return func(o *Options) error {
+		o.group.before = append(o.group.before, names...)
+		return nil
+	}
+}
+
+// WithRunAfter configures the hooks being configured to be called after the
+// hooks of the named groups, regardless of priority.
+func WithRunAfter(names ...string) Option {
+	return func(o *Options) error {
+		o.group.after = append(o.group.after, names...)
+		return nil
+	}
+}
+
+// flatten returns the registrations and all of their (nested) groups, in the
+// order they were configured.
+func flatten(regs []*Options) []*Options {
+	var all []*Options
+	for _, r := range regs {
+		all = append(all, r)
+		all = append(all, flatten(r.groups)...)
+	}
+	return all
+}
+
+// resolve orders the hooks of all registrations and groups and combines them
+// into a new set of options. Groups are ordered by their before/after
+// constraints first, then by priority and then by registration order. It
+// returns an error if a group name is duplicated, the constraints contain a
+// cycle or, unless lenient is set (as it is when hooks are removed), a
+// constraint refers to an unknown group or the order of two named groups is
+// ambiguous.
+func resolve(regs []*Options, lenient bool) (*Options, error) {
+	groups := flatten(regs)
+
+	index := map[string]int{}
+	for i, g := range groups {
+		if g.group.name == "" {
+			continue
+		}
+		if _, ok := index[g.group.name]; ok {
+			return nil, fmt.Errorf("hook group %q is defined more than once", g.group.name)
+		}
+		index[g.group.name] = i
+	}
+
+	// succ[i] are the groups that must be called after group i.
+	succ := make([][]int, len(groups))
+	preds := make([]int, len(groups))
+	edge := func(from, to int) {
+		succ[from] = append(succ[from], to)
+		preds[to]++
+	}
+	for i, g := range groups {
+		for _, n := range g.group.before {
+			j, ok := index[n]
+			if !ok && lenient {
+				continue
+			} else if !ok {
+				return nil, fmt.Errorf("hook group %s must run before unknown group %q", groupName(g), n)
+			}
+			edge(i, j)
+		}
+		for _, n := range g.group.after {
+			j, ok := index[n]
+			if !ok && lenient {
+				continue
+			} else if !ok {
+				return nil, fmt.Errorf("hook group %s must run after unknown group %q", groupName(g), n)
+			}
+			edge(j, i)
+		}
+	}
+
+	merged := &Options{}
+	done := make([]bool, len(groups))
+	for range groups {
+		next := -1
+		for i, g := range groups {
+			if done[i] || preds[i] > 0 {
+				continue
+			}
+			if next == -1 || g.group.priority > groups[next].group.priority {
+				next = i
+			}
+		}
+		if next == -1 {
+			var names []string
+			for i, g := range groups {
+				if !done[i] {
+					names = append(names, groupName(g))
+				}
+			}
+			return nil, fmt.Errorf("hook group ordering contains a cycle involving %s", strings.Join(names, ", "))
+		}
+		done[next] = true
+		for _, j := range succ[next] {
+			preds[j]--
+		}
+		merged.merge(groups[next])
+	}
+
+	if !lenient {
+		if err := ambiguous(groups, succ); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+// ambiguous returns an error if two named groups have equal priority and are
+// not ordered by their before/after constraints, directly or indirectly, as
+// their order would only depend on the order they were registered in.
+func ambiguous(groups []*Options, succ [][]int) error {
+	// reach[i][j] is true if group j must be called after group i.
+	reach := make([][]bool, len(groups))
+	var visit func(from, i int)
+	visit = func(from, i int) {
+		for _, j := range succ[i] {
+			if !reach[from][j] {
+				reach[from][j] = true
+				visit(from, j)
+			}
+		}
+	}
+	for i := range groups {
+		reach[i] = make([]bool, len(groups))
+		visit(i, i)
+	}
+
+	for i, a := range groups {
+		for j := i + 1; j < len(groups); j++ {
+			b := groups[j]
+			if a.group.name == "" || b.group.name == "" || a.group.priority != b.group.priority {
+				continue
+			}
+			if !reach[i][j] && !reach[j][i] {
+				return fmt.Errorf("hook groups %q and %q have equal priority and no ordering constraint", a.group.name, b.group.name)
+			}
+		}
+	}
+	return nil
+}
+
+// groupName returns a printable name for a group.
+func groupName(o *Options) string {
+	if o.group.name == "" {
+		return "(unnamed)"
+	}
+	return fmt.Sprintf("%q", o.group.name)
+}
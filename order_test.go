@@ -0,0 +1,175 @@
+package hook
+
+import (
+	"testing"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/ipfs/go-datastore"
+)
+
+func TestHookPriority(t *testing.T) {
+	var order []string
+
+	onAfterGet := func(name string) AfterGetFunc {
+		return func(c *call.Call, k datastore.Key, v []byte, err error) ([]byte, error) {
+			order = append(order, name)
+			return v, err
+		}
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(
+		ds,
+		WithAfterGet(onAfterGet("default")),
+		WithGroup("low", WithPriority(-1), WithAfterGet(onAfterGet("low"))),
+		WithGroup("high", WithPriority(10), WithAfterGet(onAfterGet("high"))),
+	)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	hds.Get(datastore.NewKey("test"))
+
+	expected := []string{"high", "default", "low"}
+	if len(order) != len(expected) {
+		t.Fatal("incorrect hook order", order)
+	}
+	for i, name := range expected {
+		if order[i] != name {
+			t.Fatal("incorrect hook order", order)
+		}
+	}
+}
+
+func TestHookRunBeforeAfter(t *testing.T) {
+	var order []string
+
+	onAfterGet := func(name string) AfterGetFunc {
+		return func(c *call.Call, k datastore.Key, v []byte, err error) ([]byte, error) {
+			order = append(order, name)
+			return v, err
+		}
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(
+		ds,
+		WithGroup("validate", WithPriority(10), WithAfterGet(onAfterGet("validate"))),
+		WithGroup("decrypt", WithRunBefore("validate"), WithAfterGet(onAfterGet("decrypt"))),
+		WithGroup("log", WithRunAfter("validate"), WithPriority(20), WithAfterGet(onAfterGet("log"))),
+	)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	hds.Get(datastore.NewKey("test"))
+
+	expected := []string{"decrypt", "validate", "log"}
+	if len(order) != len(expected) {
+		t.Fatal("incorrect hook order", order)
+	}
+	for i, name := range expected {
+		if order[i] != name {
+			t.Fatal("incorrect hook order", order)
+		}
+	}
+}
+
+func TestHookOrderCycle(t *testing.T) {
+	_, err := NewDatastore(
+		datastore.NewMapDatastore(),
+		WithGroup("a", WithRunBefore("b")),
+		WithGroup("b", WithRunBefore("c")),
+		WithGroup("c", WithRunBefore("a")),
+	)
+	if err == nil {
+		t.Fatal("expected cycle error")
+	}
+}
+
+func TestHookOrderAmbiguous(t *testing.T) {
+	_, err := NewDatastore(datastore.NewMapDatastore(), WithGroup("a"), WithGroup("b"))
+	if err == nil {
+		t.Fatal("expected ambiguous order error")
+	}
+
+	_, err = NewDatastore(datastore.NewMapDatastore(), WithGroup("a"), WithGroup("b", WithPriority(1)))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	// ordered indirectly
+	_, err = NewDatastore(
+		datastore.NewMapDatastore(),
+		WithGroup("a", WithRunBefore("b")),
+		WithGroup("b"),
+		WithGroup("c", WithRunAfter("b")),
+	)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+func TestHookOrderUnknownGroup(t *testing.T) {
+	_, err := NewDatastore(datastore.NewMapDatastore(), WithGroup("a", WithRunAfter("b")))
+	if err == nil {
+		t.Fatal("expected unknown group error")
+	}
+}
+
+func TestHookOrderDuplicateGroup(t *testing.T) {
+	_, err := NewDatastore(datastore.NewMapDatastore(), WithGroup("a"), WithGroup("a"))
+	if err == nil {
+		t.Fatal("expected duplicate group error")
+	}
+}
+
+func TestAddHookOrder(t *testing.T) {
+	var order []string
+
+	onAfterGet := func(name string) AfterGetFunc {
+		return func(c *call.Call, k datastore.Key, v []byte, err error) ([]byte, error) {
+			order = append(order, name)
+			return v, err
+		}
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, WithGroup("validate", WithAfterGet(onAfterGet("validate"))))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	remove, err := hds.AddHook(WithGroup("decrypt", WithRunBefore("validate"), WithAfterGet(onAfterGet("decrypt"))))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	_, err = hds.AddHook(WithGroup("other", WithRunBefore("decrypt"), WithRunAfter("validate")))
+	if err == nil {
+		t.Fatal("expected cycle error")
+	}
+
+	hds.Get(datastore.NewKey("test"))
+
+	if len(order) != 2 || order[0] != "decrypt" || order[1] != "validate" {
+		t.Fatal("incorrect hook order", order)
+	}
+
+	remove()
+	order = nil
+
+	_, err = hds.AddHook(WithRunAfter("decrypt"))
+	if err == nil {
+		t.Fatal("expected unknown group error")
+	}
+
+	hds.Get(datastore.NewKey("test"))
+
+	if len(order) != 1 || order[0] != "validate" {
+		t.Fatal("incorrect hook order", order)
+	}
+}
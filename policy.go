@@ -0,0 +1,96 @@
+package hook
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// QueryPolicy restricts the queries that can be made, e.g. to stop unbounded
+// scans of the whole datastore. The zero value allows every query.
+type QueryPolicy struct {
+	// MinPrefixDepth is the minimum number of namespaces in the prefix of a
+	// query, e.g. 2 requires a prefix like "/blocks/CIQ".
+	MinPrefixDepth int
+	// MaxLimit caps the Limit of queries. Queries with no Limit, or a greater
+	// Limit, have it reduced to MaxLimit.
+	MaxLimit int
+	// ForbidOrders rejects queries with Orders, which backends that cannot
+	// order natively sort in memory, other than those in AllowedOrders.
+	ForbidOrders bool
+	// AllowedOrders are the orders that are allowed when ForbidOrders is set,
+	// e.g. query.OrderByKey{} for backends that iterate in key order. Orders
+	// are matched by type.
+	AllowedOrders []query.Order
+	// KeysOnly forces queries to be KeysOnly when it returns true, e.g. for
+	// callers identified by a value attached to the call by an earlier hook.
+	KeysOnly func(*call.Call, query.Query) bool
+}
+
+// QueryPolicyError is the error returned by Query for queries rejected by a
+// QueryPolicy.
+type QueryPolicyError struct {
+	Query  query.Query
+	Reason string
+}
+
+func (e *QueryPolicyError) Error() string {
+	return fmt.Sprintf("hook: query policy: %s", e.Reason)
+}
+
+// WithQueryPolicy configures a before Query hook that enforces `p`.
+func WithQueryPolicy(p QueryPolicy) Option {
+	return func(o *Options) error {
+		if p.MinPrefixDepth < 0 {
+			return fmt.Errorf("invalid query policy min prefix depth %d", p.MinPrefixDepth)
+		}
+		if p.MaxLimit < 0 {
+			return fmt.Errorf("invalid query policy max limit %d", p.MaxLimit)
+		}
+		o.BeforeQuery = append(o.BeforeQuery, p.enforce)
+		return nil
+	}
+}
+
+// enforce is the before Query hook of the policy.
+func (p QueryPolicy) enforce(c *call.Call, q query.Query) (query.Query, error) {
+	if depth := prefixDepth(q.Prefix); depth < p.MinPrefixDepth {
+		reason := fmt.Sprintf("prefix %q has depth %d, minimum is %d", q.Prefix, depth, p.MinPrefixDepth)
+		return q, &QueryPolicyError{Query: q, Reason: reason}
+	}
+	if p.ForbidOrders {
+		for _, order := range q.Orders {
+			if !p.allowed(order) {
+				return q, &QueryPolicyError{Query: q, Reason: fmt.Sprintf("order %s is forbidden", order)}
+			}
+		}
+	}
+	if p.MaxLimit > 0 && (q.Limit == 0 || q.Limit > p.MaxLimit) {
+		q.Limit = p.MaxLimit
+	}
+	if p.KeysOnly != nil && !q.KeysOnly && p.KeysOnly(c, q) {
+		q.KeysOnly = true
+	}
+	return q, nil
+}
+
+func (p QueryPolicy) allowed(order query.Order) bool {
+	for _, a := range p.AllowedOrders {
+		if reflect.TypeOf(a) == reflect.TypeOf(order) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixDepth returns the number of namespaces in a query prefix.
+func prefixDepth(prefix string) int {
+	k := datastore.NewKey(prefix)
+	if k.String() == "/" {
+		return 0
+	}
+	return len(k.Namespaces())
+}
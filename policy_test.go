@@ -0,0 +1,92 @@
+package hook
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+type callerKey struct{}
+
+func TestQueryPolicyReject(t *testing.T) {
+	hds, err := NewDatastore(datastore.NewMapDatastore(), WithQueryPolicy(QueryPolicy{
+		MinPrefixDepth: 2,
+		ForbidOrders:   true,
+		AllowedOrders:  []query.Order{query.OrderByKey{}},
+	}))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	rejected := []query.Query{
+		{},
+		{Prefix: "/"},
+		{Prefix: "/blocks"},
+		{Prefix: "/blocks/CIQ", Orders: []query.Order{query.OrderByValue{}}},
+	}
+	for _, q := range rejected {
+		_, err := hds.Query(q)
+		var perr *QueryPolicyError
+		if !errors.As(err, &perr) {
+			t.Fatal("expected query policy error", q, err)
+		}
+	}
+
+	res, err := hds.Query(query.Query{Prefix: "/blocks/CIQ", Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	res.Close()
+}
+
+func TestQueryPolicyRewrite(t *testing.T) {
+	var queries []query.Query
+
+	hds, err := NewDatastore(
+		datastore.NewMapDatastore(),
+		WithBeforeQuery(func(c *call.Call, q query.Query) (query.Query, error) {
+			if q.Prefix == "/untrusted" {
+				c.Set(callerKey{}, "untrusted")
+			}
+			return q, nil
+		}),
+		WithQueryPolicy(QueryPolicy{
+			MaxLimit: 10,
+			KeysOnly: func(c *call.Call, q query.Query) bool {
+				return c.Value(callerKey{}) == "untrusted"
+			},
+		}),
+		WithBeforeQuery(func(c *call.Call, q query.Query) (query.Query, error) {
+			queries = append(queries, q)
+			return q, nil
+		}),
+	)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for _, q := range []query.Query{{Prefix: "/trusted", Limit: 5}, {Prefix: "/untrusted", Limit: 100}} {
+		res, err := hds.Query(q)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		res.Close()
+	}
+
+	if queries[0].Limit != 5 || queries[0].KeysOnly {
+		t.Fatal("incorrect trusted query", queries[0])
+	}
+	if queries[1].Limit != 10 || !queries[1].KeysOnly {
+		t.Fatal("incorrect untrusted query", queries[1])
+	}
+}
+
+func TestQueryPolicyInvalid(t *testing.T) {
+	_, err := NewDatastore(datastore.NewMapDatastore(), WithQueryPolicy(QueryPolicy{MaxLimit: -1}))
+	if err == nil {
+		t.Fatal("expected invalid query policy error")
+	}
+}
@@ -0,0 +1,155 @@
+package results
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Limit is a limit on the iteration of query results.
+type Limit int
+
+const (
+	// LimitDuration limits the time since the results were created.
+	LimitDuration Limit = iota
+	// LimitEntries limits the number of entries read.
+	LimitEntries
+	// LimitBytes limits the total size of the keys and values of the entries
+	// read.
+	LimitBytes
+)
+
+func (l Limit) String() string {
+	switch l {
+	case LimitDuration:
+		return "max duration"
+	case LimitEntries:
+		return "max entries"
+	default:
+		return "max bytes"
+	}
+}
+
+// LimitError is the error of the terminal result delivered when a limit is
+// exceeded.
+type LimitError struct {
+	Limit Limit
+	// Max is the configured maximum, in nanoseconds for LimitDuration.
+	Max int64
+}
+
+func (e *LimitError) Error() string {
+	max := fmt.Sprint(e.Max)
+	if e.Limit == LimitDuration {
+		max = time.Duration(e.Max).String()
+	}
+	return fmt.Sprintf("results: %s of %s exceeded", e.Limit, max)
+}
+
+// limits are the iteration limits of results and the usage counted towards
+// them. It is guarded by the mutex of the results.
+type limits struct {
+	err        error
+	terminated bool
+	closed     bool
+	entries    int
+	bytes      int
+	timer      *time.Timer
+	// exceeded is closed when a limit is exceeded.
+	exceeded chan struct{}
+}
+
+// limited returns true if any iteration limits are configured.
+func (o *Options) limited() bool {
+	return o.MaxDuration > 0 || o.MaxEntries > 0 || o.MaxBytes > 0
+}
+
+// startLimits starts the timer for the max duration limit.
+func (hres *Results) startLimits() {
+	hres.mu.Lock()
+	defer hres.mu.Unlock()
+	hres.limits.exceeded = make(chan struct{})
+	if d := hres.options.MaxDuration; d > 0 {
+		hres.limits.timer = time.AfterFunc(d, func() {
+			hres.exceed(&LimitError{Limit: LimitDuration, Max: int64(d)})
+		})
+	}
+}
+
+// guard counts the entry of `r` towards the limits, returning the limit error
+// instead if it would exceed them or a limit has already been exceeded.
+func (hres *Results) guard(r query.Result) error {
+	if r.Error != nil {
+		return hres.limitErr()
+	}
+	o := hres.options
+	size := len(r.Key) + len(r.Value)
+
+	hres.mu.Lock()
+	var err error
+	switch {
+	case hres.limits.err != nil:
+		err = hres.limits.err
+	case o.MaxEntries > 0 && hres.limits.entries+1 > o.MaxEntries:
+		err = &LimitError{Limit: LimitEntries, Max: int64(o.MaxEntries)}
+	case o.MaxBytes > 0 && hres.limits.bytes+size > o.MaxBytes:
+		err = &LimitError{Limit: LimitBytes, Max: int64(o.MaxBytes)}
+	default:
+		hres.limits.entries++
+		hres.limits.bytes += size
+	}
+	hres.mu.Unlock()
+
+	if err != nil {
+		hres.exceed(err)
+	}
+	return err
+}
+
+// limitErr returns the limit error if a limit has been exceeded.
+func (hres *Results) limitErr() error {
+	hres.mu.Lock()
+	defer hres.mu.Unlock()
+	return hres.limits.err
+}
+
+// exceed records that a limit has been exceeded. Only the first limit exceeded
+// is recorded. The underlying results are not closed, as they may be being
+// read and some results, e.g. those of iterators, cannot be closed while they
+// are being read. They are closed by closeExceeded instead.
+func (hres *Results) exceed(err error) {
+	hres.mu.Lock()
+	defer hres.mu.Unlock()
+	if hres.limits.err != nil {
+		return
+	}
+	hres.limits.err = err
+	close(hres.limits.exceeded)
+}
+
+// closeExceeded closes the underlying results once a limit has been exceeded.
+// It must only be called by the goroutine reading them.
+func (hres *Results) closeExceeded() {
+	hres.mu.Lock()
+	closed := hres.limits.closed
+	hres.limits.closed = true
+	hres.mu.Unlock()
+	if closed {
+		return
+	}
+	hres.done()
+	hres.res.Close()
+}
+
+// terminal returns the terminal result the first time it is called after a
+// limit has been exceeded and no result thereafter.
+func (hres *Results) terminal() (query.Result, bool) {
+	hres.mu.Lock()
+	defer hres.mu.Unlock()
+	if hres.limits.terminated {
+		return query.Result{}, false
+	}
+	hres.limits.terminated = true
+	return query.Result{Error: hres.limits.err}, true
+}
@@ -0,0 +1,166 @@
+package results
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore/query"
+)
+
+func checkLimit(t *testing.T, err error, l Limit) {
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != l {
+		t.Fatal("expected limit error", l, err)
+	}
+}
+
+func TestMaxEntriesNextSync(t *testing.T) {
+	hres := newResults(t, WithMaxEntries(2))
+	defer hres.Close()
+
+	var rs []query.Result
+	for {
+		r, ok := hres.NextSync()
+		if !ok {
+			break
+		}
+		rs = append(rs, r)
+	}
+
+	if len(rs) != 3 || rs[0].Key != "/a" || rs[1].Key != "/b" {
+		t.Fatal("incorrect results", rs)
+	}
+	checkLimit(t, rs[2].Error, LimitEntries)
+}
+
+func TestMaxEntriesNotExceeded(t *testing.T) {
+	hres := newResults(t, WithMaxEntries(4))
+	defer hres.Close()
+
+	es, err := hres.Rest()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(es) != 4 {
+		t.Fatal("incorrect entries", es)
+	}
+}
+
+func TestMaxBytesRest(t *testing.T) {
+	// each entry is 3 bytes, e.g. "/a" and "a"
+	hres := newResults(t, WithMaxBytes(7))
+	defer hres.Close()
+
+	es, err := hres.Rest()
+	checkLimit(t, err, LimitBytes)
+	if len(es) != 2 || es[0].Key != "/a" || es[1].Key != "/b" {
+		t.Fatal("incorrect entries", es)
+	}
+}
+
+func TestMaxEntriesNext(t *testing.T) {
+	hres := newResults(t, WithMaxEntries(1))
+	defer hres.Close()
+
+	var rs []query.Result
+	for r := range hres.Next() {
+		rs = append(rs, r)
+	}
+
+	if len(rs) != 2 || rs[0].Key != "/a" {
+		t.Fatal("incorrect results", rs)
+	}
+	checkLimit(t, rs[1].Error, LimitEntries)
+}
+
+func TestMaxDurationNext(t *testing.T) {
+	hres := newResults(t, WithMaxDuration(10*time.Millisecond))
+	defer hres.Close()
+
+	ch := hres.Next()
+	r := <-ch
+	if r.Key != "/a" {
+		t.Fatal("incorrect result", r)
+	}
+
+	// slow consumer
+	time.Sleep(50 * time.Millisecond)
+
+	var rs []query.Result
+	for r := range ch {
+		rs = append(rs, r)
+	}
+	if len(rs) != 1 {
+		t.Fatal("expected terminal result", rs)
+	}
+	checkLimit(t, rs[0].Error, LimitDuration)
+
+	_, ok := hres.NextSync()
+	if ok {
+		t.Fatal("expected no results after terminal result")
+	}
+}
+
+// slowIterator is a stateful iterator that is not safe to close while it is
+// being read, like the iterators of leveldb or badger.
+type slowIterator struct {
+	keys []string
+	pos  int
+}
+
+func (it *slowIterator) next() (query.Result, bool) {
+	time.Sleep(time.Millisecond)
+	if it.keys == nil {
+		panic("read closed iterator")
+	}
+	if it.pos == len(it.keys) {
+		return query.Result{}, false
+	}
+	it.pos++
+	return query.Result{Entry: query.Entry{Key: it.keys[it.pos-1]}}, true
+}
+
+func (it *slowIterator) close() error {
+	it.keys = nil
+	return nil
+}
+
+func TestMaxDurationIterator(t *testing.T) {
+	it := &slowIterator{keys: make([]string, 100)}
+	for i := range it.keys {
+		it.keys[i] = fmt.Sprintf("/%d", i)
+	}
+	res := query.ResultsFromIterator(query.Query{}, query.Iterator{Next: it.next, Close: it.close})
+
+	hres, err := NewResults(res, WithMaxDuration(2*time.Millisecond))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hres.Close()
+
+	var rs []query.Result
+	for {
+		r, ok := hres.NextSync()
+		if !ok {
+			break
+		}
+		rs = append(rs, r)
+	}
+
+	if len(rs) == 0 || len(rs) > 50 {
+		t.Fatal("incorrect results", len(rs))
+	}
+	checkLimit(t, rs[len(rs)-1].Error, LimitDuration)
+}
+
+func TestInvalidLimits(t *testing.T) {
+	options := []Option{WithMaxDuration(-1), WithMaxEntries(-1), WithMaxBytes(-1)}
+	for _, opt := range options {
+		_, err := NewResults(nil, opt)
+		if err == nil {
+			t.Fatal("expected invalid limit error")
+		}
+	}
+}
@@ -2,44 +2,84 @@ package results
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/internal/recovery"
+	"github.com/alanshaw/ipfs-hookds/internal/validate"
 	"github.com/ipfs/go-datastore/query"
 )
 
 // BeforeNextFunc is a handler for the before Next hook
-type BeforeNextFunc func()
+// Returning a non-nil channel skips the underlying Next and the channel is
+// passed to the after hooks instead, without calling the entry hooks.
+type BeforeNextFunc func(*call.Call) <-chan query.Result
 
 // AfterNextFunc is a handler for the after Next hook
-type AfterNextFunc func(<-chan query.Result) <-chan query.Result
+type AfterNextFunc func(*call.Call, <-chan query.Result) <-chan query.Result
 
-// BeforeNextSyncFunc is a handler for the before NextSync hook
-type BeforeNextSyncFunc func()
+// BeforeNextSyncFunc is a handler for the before NextSync hook, it returns a
+// result, ok and whether it handled the NextSync.
+// Returning handled skips the underlying NextSync and the result and ok are
+// passed to the after hooks instead, without calling the entry hooks.
+type BeforeNextSyncFunc func(*call.Call) (query.Result, bool, bool)
 
 // AfterNextSyncFunc is a handler for the after NextSync hook
-type AfterNextSyncFunc func(query.Result, bool) (query.Result, bool)
+type AfterNextSyncFunc func(*call.Call, query.Result, bool) (query.Result, bool)
 
-// BeforeRestFunc is a handler for the before Rest hook
-type BeforeRestFunc func() ([]query.Entry, error)
+// BeforeRestFunc is a handler for the before Rest hook, it returns entries,
+// whether it handled the Rest and an error.
+// Returning handled skips the underlying Rest and the entries are passed to the
+// after hooks instead, without calling the entry hooks, e.g. to serve cached
+// results, which may be empty.
+// Returning an error aborts the Rest and the error is passed to the after hooks.
+type BeforeRestFunc func(*call.Call) ([]query.Entry, bool, error)
 
 // AfterRestFunc is a handler for the after Rest hook
-type AfterRestFunc func([]query.Entry, error) ([]query.Entry, error)
+type AfterRestFunc func(*call.Call, []query.Entry, error) ([]query.Entry, error)
 
 // BeforeCloseFunc is a handler for the before Close hook
-type BeforeCloseFunc func()
+type BeforeCloseFunc func(*call.Call)
 
 // AfterCloseFunc is a handler for the after Close hook
-type AfterCloseFunc func(error) error
+type AfterCloseFunc func(*call.Call, error) error
 
-// Options are results options.
+// EntryFunc is a handler for the entry hook, it is called for each entry read
+// by Next, NextSync or Rest and returns the entry to use instead and whether it
+// should be kept. Returning an error replaces the entry with an error result.
+type EntryFunc func(*call.Call, query.Entry) (query.Entry, bool, error)
+
+// ValidateFunc validates options once all options have been applied.
+type ValidateFunc func(*Options) error
+
+// Options are results options. Hooks configured for the same method are called
+// in order, each receiving the output of the previous hook.
 type Options struct {
-	BeforeNext     BeforeNextFunc
-	AfterNext      AfterNextFunc
-	BeforeNextSync BeforeNextSyncFunc
-	AfterNextSync  AfterNextSyncFunc
-	BeforeRest     BeforeRestFunc
-	AfterRest      AfterRestFunc
-	BeforeClose    BeforeCloseFunc
-	AfterClose     AfterCloseFunc
+	BeforeNext     []BeforeNextFunc
+	AfterNext      []AfterNextFunc
+	BeforeNextSync []BeforeNextSyncFunc
+	AfterNextSync  []AfterNextSyncFunc
+	BeforeRest     []BeforeRestFunc
+	AfterRest      []AfterRestFunc
+	BeforeClose    []BeforeCloseFunc
+	AfterClose     []AfterCloseFunc
+	Entry          []EntryFunc
+
+	Interceptors []call.Interceptor
+
+	// Tracker tracks the results until they are closed or fully read.
+	Tracker *Tracker
+
+	// MaxDuration, MaxEntries and MaxBytes limit the iteration of the results,
+	// zero meaning no limit. See WithMaxDuration, WithMaxEntries and
+	// WithMaxBytes.
+	MaxDuration time.Duration
+	MaxEntries  int
+	MaxBytes    int
+
+	validators    []validate.Func
+	panicRecovery bool
+	onPanic       []func(*call.PanicError)
 }
 
 // Option is the results option type.
@@ -55,74 +95,226 @@ func (o *Options) Apply(opts ...Option) error {
 	return nil
 }
 
+// validate checks that no hooks are nil and calls the configured validators.
+func (o *Options) validate() error {
+	return validate.Check("results options", o, o.validators)
+}
+
+// Validate applies the options and validates them without creating results,
+// e.g. to check options that are applied to the results of later queries.
+func Validate(options ...Option) error {
+	opts := Options{}
+	if err := opts.Apply(options...); err != nil {
+		return err
+	}
+	return opts.validate()
+}
+
+// recoverPanics replaces the hooks and interceptors with ones that recover
+// from panics, if configured WithPanicRecovery.
+func (o *Options) recoverPanics() {
+	if !o.panicRecovery {
+		return
+	}
+	onPanic := func(perr *call.PanicError) {
+		for _, f := range o.onPanic {
+			f(perr)
+		}
+	}
+	recovery.Hooks(o, onPanic, "Interceptors")
+	o.Interceptors = recovery.Interceptors(o.Interceptors, onPanic)
+}
+
+// WithValidator configures a function that validates the options once all
+// options have been applied, allowing bad combinations to be rejected.
+func WithValidator(f ValidateFunc) Option {
+	return func(o *Options) error {
+		o.validators = append(o.validators, func(o interface{}) error {
+			return f(o.(*Options))
+		})
+		return nil
+	}
+}
+
+// Exclusive configures the hooks added by `opt` to be exclusive. Options are
+// invalid if any other hooks are configured for the same methods.
+func Exclusive(opt Option) Option {
+	return func(o *Options) error {
+		check, err := validate.Exclusive(o, func() error { return opt(o) })
+		if err != nil {
+			return err
+		}
+		o.validators = append(o.validators, check)
+		return nil
+	}
+}
+
 // WithBeforeNext configures a hook that is called _before_ Next.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforeNext(f BeforeNextFunc) Option {
 	return func(o *Options) error {
-		o.BeforeNext = f
+		o.BeforeNext = append(o.BeforeNext, f)
 		return nil
 	}
 }
 
 // WithAfterNext configures a hook that is called _after_ Next.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterNext(f AfterNextFunc) Option {
 	return func(o *Options) error {
-		o.AfterNext = f
+		o.AfterNext = append(o.AfterNext, f)
 		return nil
 	}
 }
 
 // WithBeforeNextSync configures a hook that is called _before_ NextSync.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforeNextSync(f BeforeNextSyncFunc) Option {
 	return func(o *Options) error {
-		o.BeforeNextSync = f
+		o.BeforeNextSync = append(o.BeforeNextSync, f)
 		return nil
 	}
 }
 
 // WithAfterNextSync configures a hook that is called _after_ NextSync.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterNextSync(f AfterNextSyncFunc) Option {
 	return func(o *Options) error {
-		o.AfterNextSync = f
+		o.AfterNextSync = append(o.AfterNextSync, f)
 		return nil
 	}
 }
 
 // WithBeforeRest configures a hook that is called _before_ Rest.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforeRest(f BeforeRestFunc) Option {
 	return func(o *Options) error {
-		o.BeforeRest = f
+		o.BeforeRest = append(o.BeforeRest, f)
 		return nil
 	}
 }
 
 // WithAfterRest configures a hook that is called _after_ Rest.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterRest(f AfterRestFunc) Option {
 	return func(o *Options) error {
-		o.AfterRest = f
+		o.AfterRest = append(o.AfterRest, f)
 		return nil
 	}
 }
 
 // WithBeforeClose configures a hook that is called _before_ Close.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithBeforeClose(f BeforeCloseFunc) Option {
 	return func(o *Options) error {
-		o.BeforeClose = f
+		o.BeforeClose = append(o.BeforeClose, f)
 		return nil
 	}
 }
 
 // WithAfterClose configures a hook that is called _after_ Rest.
+// Multiple hooks are called in the order they were configured.
 // Defaults to noop.
 func WithAfterClose(f AfterCloseFunc) Option {
 	return func(o *Options) error {
-		o.AfterClose = f
+		o.AfterClose = append(o.AfterClose, f)
+		return nil
+	}
+}
+
+// WithEntry configures a hook that is called for each entry read by Next,
+// NextSync or Rest. It may modify, drop or fail the entry.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithEntry(f EntryFunc) Option {
+	return func(o *Options) error {
+		o.Entry = append(o.Entry, f)
+		return nil
+	}
+}
+
+// WithInterceptor configures middleware that is called around every operation,
+// including the before and after hooks.
+// Multiple interceptors are called in the order they were configured, the
+// first being the outermost.
+func WithInterceptor(i call.Interceptor) Option {
+	return func(o *Options) error {
+		o.Interceptors = append(o.Interceptors, i)
+		return nil
+	}
+}
+
+// WithTracker configures the results to be tracked by `t` until they are
+// closed or fully read.
+func WithTracker(t *Tracker) Option {
+	return func(o *Options) error {
+		if t == nil {
+			return fmt.Errorf("nil tracker")
+		}
+		o.Tracker = t
+		return nil
+	}
+}
+
+// WithMaxDuration limits the time the results can be read for, starting when
+// they are created. Once it has elapsed the underlying results are closed by
+// the goroutine reading them, as they may not be safe to close while they are
+// being read, and a terminal result with a *LimitError is delivered by Next,
+// NextSync or Rest.
+func WithMaxDuration(d time.Duration) Option {
+	return func(o *Options) error {
+		if d < 0 {
+			return fmt.Errorf("invalid max duration %s", d)
+		}
+		o.MaxDuration = d
+		return nil
+	}
+}
+
+// WithMaxEntries limits the number of entries that can be read. Reading more
+// entries closes the underlying results and delivers a terminal result with a
+// *LimitError instead.
+func WithMaxEntries(n int) Option {
+	return func(o *Options) error {
+		if n < 0 {
+			return fmt.Errorf("invalid max entries %d", n)
+		}
+		o.MaxEntries = n
+		return nil
+	}
+}
+
+// WithMaxBytes limits the total size of the keys and values of the entries
+// that can be read. Reading an entry that exceeds it closes the underlying
+// results and delivers a terminal result with a *LimitError instead.
+func WithMaxBytes(n int) Option {
+	return func(o *Options) error {
+		if n < 0 {
+			return fmt.Errorf("invalid max bytes %d", n)
+		}
+		o.MaxBytes = n
+		return nil
+	}
+}
+
+// WithPanicRecovery causes panics in hooks and interceptors to be recovered and
+// converted into a *call.PanicError that is returned by the hook, so that it is
+// handled like any other hook error. If not nil, `f` is called for each
+// recovered panic, e.g. to log or count it. Hooks that do not return an error
+// return zero values after a recovered panic.
+func WithPanicRecovery(f func(*call.PanicError)) Option {
+	return func(o *Options) error {
+		o.panicRecovery = true
+		if f != nil {
+			o.onPanic = append(o.onPanic, f)
+		}
 		return nil
 	}
 }
@@ -1,6 +1,11 @@
 package results
 
 import (
+	"sync"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/internal/hookerr"
+	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
 	"github.com/jbenet/goprocess"
 )
@@ -8,12 +13,38 @@ import (
 type Results struct {
 	res     query.Results
 	options Options
+
+	// proc is the process of the results. It closes the underlying results
+	// when it is closed and the entries are forwarded by it's children.
+	proc     goprocess.Process
+	linkOnce sync.Once
+
+	mu     sync.Mutex
+	limits limits
 }
 
-func NewResults(res query.Results, options ...Option) *Results {
+func NewResults(res query.Results, options ...Option) (*Results, error) {
 	opts := Options{}
-	opts.Apply(options...)
-	return &Results{res: res, options: opts}
+	if err := opts.Apply(options...); err != nil {
+		return nil, err
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	opts.recoverPanics()
+	hres := &Results{res: res, options: opts}
+	hres.proc = goprocess.WithTeardown(func() error {
+		hres.done()
+		return res.Close()
+	})
+
+	if opts.Tracker != nil {
+		opts.Tracker.track(hres)
+	}
+	if opts.limited() {
+		hres.startLimits()
+	}
+	return hres, nil
 }
 
 func (hres *Results) Query() query.Query {
@@ -21,49 +52,278 @@ func (hres *Results) Query() query.Query {
 }
 
 func (hres *Results) Next() <-chan query.Result {
-	if hres.options.BeforeNext != nil {
-		hres.options.BeforeNext()
-	}
-	c := hres.res.Next()
-	if hres.options.AfterNext != nil {
-		c = hres.options.AfterNext(c)
-	}
-	return c
+	op := call.Op{Call: call.New("Results.Next")}
+	result := call.Invoke(hres.options.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		var ch <-chan query.Result
+		for _, f := range hres.options.BeforeNext {
+			if ch = f(c); ch != nil {
+				break
+			}
+		}
+		if ch == nil {
+			ch = hres.res.Next()
+			if len(hres.options.Entry) > 0 || hres.options.Tracker != nil || hres.options.limited() {
+				ch = hres.forward(c, ch)
+			}
+		}
+		for _, f := range hres.options.AfterNext {
+			ch = f(c, ch)
+		}
+		return call.Result{Next: ch}
+	})
+	return result.Next
 }
 
 func (hres *Results) NextSync() (query.Result, bool) {
-	if hres.options.BeforeNextSync != nil {
-		hres.options.BeforeNextSync()
+	op := call.Op{Call: call.New("Results.NextSync")}
+	result := call.Invoke(hres.options.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		var r query.Result
+		var ok, handled bool
+		for _, f := range hres.options.BeforeNextSync {
+			if r, ok, handled = f(c); handled {
+				r.Error = hookerr.Wrap(c, "BeforeNextSync", f, datastore.Key{}, nil, r.Error)
+				break
+			}
+		}
+		if !handled {
+			r, ok = hres.nextSync(c)
+		}
+		for _, f := range hres.options.AfterNextSync {
+			prev := r.Error
+			r, ok = f(c, r, ok)
+			r.Error = hookerr.Wrap(c, "AfterNextSync", f, datastore.Key{}, prev, r.Error)
+		}
+		return call.Result{QueryResult: r, OK: ok}
+	})
+	return result.QueryResult, result.OK
+}
+
+func (hres *Results) Rest() ([]query.Entry, error) {
+	op := call.Op{Call: call.New("Results.Rest")}
+	result := call.Invoke(hres.options.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		var es []query.Entry
+		var handled bool
+		var err error
+		for _, f := range hres.options.BeforeRest {
+			if es, handled, err = f(c); err != nil {
+				err = hookerr.Wrap(c, "BeforeRest", f, datastore.Key{}, nil, err)
+				break
+			}
+			if handled {
+				break
+			}
+		}
+		if !handled && err == nil {
+			if hres.options.limited() {
+				es, err = hres.rest(c)
+			} else {
+				es, err = hres.res.Rest()
+				hres.done()
+				if err == nil && len(hres.options.Entry) > 0 {
+					es, err = hres.filter(c, es)
+				}
+			}
+		}
+		for _, f := range hres.options.AfterRest {
+			prev := err
+			es, err = f(c, es, prev)
+			err = hookerr.Wrap(c, "AfterRest", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{Entries: es, Err: err}
+	})
+	return result.Entries, result.Err
+}
+
+func (hres *Results) Close() error {
+	op := call.Op{Call: call.New("Results.Close")}
+	result := call.Invoke(hres.options.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		for _, f := range hres.options.BeforeClose {
+			f(c)
+		}
+		err := hres.proc.Close()
+		for _, f := range hres.options.AfterClose {
+			prev := err
+			err = f(c, prev)
+			err = hookerr.Wrap(c, "AfterClose", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
+}
+
+// Process returns the process of the results. Closing it closes the results
+// without calling the Close hooks.
+func (hres *Results) Process() goprocess.Process {
+	hres.link()
+	return hres.proc
+}
+
+// nextSync reads the next result from the underlying results, calling the
+// entry hooks and checking the limits.
+func (hres *Results) nextSync(c *call.Call) (query.Result, bool) {
+	limited := hres.options.limited()
+	if limited && hres.limitErr() != nil {
+		hres.closeExceeded()
+		return hres.terminal()
 	}
 	r, ok := hres.res.NextSync()
-	if hres.options.AfterNextSync != nil {
-		r, ok = hres.options.AfterNextSync(r, ok)
+	for ok && r.Error == nil && len(hres.options.Entry) > 0 {
+		var keep bool
+		if r.Entry, keep, r.Error = hres.entry(c, r.Entry); keep || r.Error != nil {
+			break
+		}
+		r, ok = hres.res.NextSync()
+	}
+	if !ok {
+		hres.done()
+		if limited && hres.limitErr() != nil {
+			return hres.terminal()
+		}
+		return r, ok
+	}
+	if limited && hres.guard(r) != nil {
+		hres.closeExceeded()
+		return hres.terminal()
 	}
 	return r, ok
 }
 
-func (hres *Results) Rest() ([]query.Entry, error) {
-	if hres.options.BeforeRest != nil {
-		hres.options.BeforeRest()
+// rest reads the remaining results with nextSync, returning the entries read
+// before the first error.
+func (hres *Results) rest(c *call.Call) ([]query.Entry, error) {
+	var es []query.Entry
+	for {
+		r, ok := hres.nextSync(c)
+		if !ok {
+			return es, nil
+		}
+		if r.Error != nil {
+			return es, r.Error
+		}
+		es = append(es, r.Entry)
 	}
-	es, err := hres.res.Rest()
-	if hres.options.AfterRest != nil {
-		es, err = hres.options.AfterRest(es, err)
+}
+
+// entry calls the entry hooks for an entry.
+func (hres *Results) entry(c *call.Call, e query.Entry) (query.Entry, bool, error) {
+	key := datastore.RawKey(e.Key)
+	for _, f := range hres.options.Entry {
+		var keep bool
+		var err error
+		if e, keep, err = f(c, e); err != nil {
+			return e, false, hookerr.Wrap(c, "Entry", f, key, nil, err)
+		}
+		if !keep {
+			return e, false, nil
+		}
 	}
-	return es, err
+	return e, true, nil
 }
 
-func (hres *Results) Close() error {
-	if hres.options.BeforeClose != nil {
-		hres.options.BeforeClose()
+// filter calls the entry hooks for each of the entries.
+func (hres *Results) filter(c *call.Call, es []query.Entry) ([]query.Entry, error) {
+	filtered := es[:0:0]
+	for _, e := range es {
+		e, keep, err := hres.entry(c, e)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			filtered = append(filtered, e)
+		}
 	}
-	err := hres.res.Close()
-	if hres.options.AfterClose != nil {
-		err = hres.options.AfterClose(err)
+	return filtered, nil
+}
+
+// forward returns a channel of the results read from `in` after calling the
+// entry hooks for them and checking the limits. It is closed when `in` is
+// closed, i.e. the results have been fully read, the results are closed or a
+// limit is exceeded, after sending the terminal result.
+func (hres *Results) forward(c *call.Call, in <-chan query.Result) <-chan query.Result {
+	out := make(chan query.Result)
+	limited := hres.options.limited()
+	hres.link()
+	hres.proc.Go(func(worker goprocess.Process) {
+		defer close(out)
+		defer hres.done()
+		for {
+			select {
+			case r, ok := <-in:
+				if !ok {
+					if limited && hres.limitErr() != nil {
+						hres.sendTerminal(worker, out)
+					}
+					return
+				}
+				if r.Error == nil && len(hres.options.Entry) > 0 {
+					var keep bool
+					if r.Entry, keep, r.Error = hres.entry(c, r.Entry); !keep && r.Error == nil {
+						continue
+					}
+				}
+				if limited && hres.guard(r) != nil {
+					hres.sendTerminal(worker, out)
+					return
+				}
+				select {
+				case out <- r:
+				case <-hres.limits.exceeded:
+					hres.sendTerminal(worker, out)
+					return
+				case <-worker.Closing():
+					return
+				}
+			case <-hres.limits.exceeded:
+				hres.sendTerminal(worker, out)
+				return
+			case <-worker.Closing():
+				return
+			}
+		}
+	})
+	return out
+}
+
+// sendTerminal closes the underlying results and sends the terminal result on
+// `out`, unless the results are closed first.
+func (hres *Results) sendTerminal(worker goprocess.Process, out chan<- query.Result) {
+	hres.closeExceeded()
+	if r, ok := hres.terminal(); ok {
+		select {
+		case out <- r:
+		case <-worker.Closing():
+		}
 	}
-	return err
 }
 
-func (hres *Results) Process() goprocess.Process {
-	return hres.res.Process()
+// link closes the process of the results once the underlying results are
+// closed, i.e. have been fully read, and the forwarded entries have been sent.
+// The process of the underlying results is only used once it is needed, as
+// using it changes how some results are read.
+func (hres *Results) link() {
+	hres.linkOnce.Do(func() {
+		closed := hres.res.Process().Closed()
+		go func() {
+			<-closed
+			hres.proc.CloseAfterChildren()
+		}()
+	})
+}
+
+// done stops tracking the results and the max duration timer once they have
+// been closed or fully read.
+func (hres *Results) done() {
+	if hres.options.Tracker != nil {
+		hres.options.Tracker.untrack(hres)
+	}
+	hres.mu.Lock()
+	timer := hres.limits.timer
+	hres.mu.Unlock()
+	if timer != nil {
+		timer.Stop()
+	}
 }
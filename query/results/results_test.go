@@ -0,0 +1,271 @@
+package results
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+var errSecret = errors.New("secret")
+
+// onEntry drops /b, fails /c and upper cases the values of other entries.
+func onEntry(c *call.Call, e query.Entry) (query.Entry, bool, error) {
+	switch e.Key {
+	case "/b":
+		return e, false, nil
+	case "/c":
+		return e, false, errSecret
+	}
+	e.Value = append([]byte("X"), e.Value...)
+	return e, true, nil
+}
+
+func newResults(t *testing.T, options ...Option) *Results {
+	ds := datastore.NewMapDatastore()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		err := ds.Put(datastore.NewKey(k), []byte(k))
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+
+	res, err := ds.Query(query.Query{Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hres, err := NewResults(res, options...)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	return hres
+}
+
+func checkResults(t *testing.T, rs []query.Result) {
+	if len(rs) != 3 {
+		t.Fatal("incorrect results", rs)
+	}
+	if rs[0].Key != "/a" || string(rs[0].Value) != "Xa" {
+		t.Fatal("incorrect result", rs[0])
+	}
+	if !errors.Is(rs[1].Error, errSecret) {
+		t.Fatal("expected entry error", rs[1])
+	}
+	if rs[2].Key != "/d" || string(rs[2].Value) != "Xd" {
+		t.Fatal("incorrect result", rs[2])
+	}
+}
+
+func TestEntryNext(t *testing.T) {
+	hres := newResults(t, WithEntry(onEntry))
+	defer hres.Close()
+
+	var rs []query.Result
+	for r := range hres.Next() {
+		rs = append(rs, r)
+	}
+	checkResults(t, rs)
+}
+
+func TestEntryNextSync(t *testing.T) {
+	hres := newResults(t, WithEntry(onEntry))
+	defer hres.Close()
+
+	var rs []query.Result
+	for {
+		r, ok := hres.NextSync()
+		if !ok {
+			break
+		}
+		rs = append(rs, r)
+	}
+	checkResults(t, rs)
+}
+
+func TestEntryRest(t *testing.T) {
+	drop := func(c *call.Call, e query.Entry) (query.Entry, bool, error) {
+		return e, e.Key != "/b", nil
+	}
+
+	hres := newResults(t, WithEntry(drop))
+	defer hres.Close()
+
+	es, err := hres.Rest()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(es) != 3 || es[0].Key != "/a" || es[1].Key != "/c" || es[2].Key != "/d" {
+		t.Fatal("incorrect entries", es)
+	}
+
+	hres = newResults(t, WithEntry(onEntry))
+	defer hres.Close()
+
+	_, err = hres.Rest()
+	if !errors.Is(err, errSecret) {
+		t.Fatal("expected entry error", err)
+	}
+}
+
+func TestEntryNextClose(t *testing.T) {
+	hres := newResults(t, WithEntry(onEntry))
+
+	ch := hres.Next()
+	<-ch
+
+	err := hres.Close()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for range ch {
+	}
+}
+
+func TestEntryNextProcessClose(t *testing.T) {
+	hres := newResults(t, WithEntry(onEntry))
+
+	ch := hres.Next()
+	<-ch
+
+	err := hres.Process().Close()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	// the forwarding goroutine exits, closing the channel
+	for range ch {
+	}
+
+	select {
+	case <-hres.Process().Closed():
+	case <-time.After(time.Second):
+		t.Fatal("expected process to be closed")
+	}
+}
+
+func TestEntryNextProcessClosedWhenRead(t *testing.T) {
+	hres := newResults(t, WithEntry(onEntry))
+
+	var rs []query.Result
+	for r := range hres.Next() {
+		rs = append(rs, r)
+	}
+	checkResults(t, rs)
+
+	select {
+	case <-hres.Process().Closed():
+	case <-time.After(time.Second):
+		t.Fatal("expected process to be closed once fully read")
+	}
+}
+
+func TestBeforeRestShortCircuit(t *testing.T) {
+	cached := []query.Entry{{Key: "/cached"}}
+
+	onBeforeRest := func(c *call.Call) ([]query.Entry, bool, error) {
+		return cached, true, nil
+	}
+
+	onAfterRest := func(c *call.Call, es []query.Entry, err error) ([]query.Entry, error) {
+		if len(es) != 1 || es[0].Key != "/cached" {
+			t.Fatal("expected cached entries", es)
+		}
+		return es, err
+	}
+
+	hres := newResults(t, WithBeforeRest(onBeforeRest), WithAfterRest(onAfterRest), WithEntry(onEntry))
+	defer hres.Close()
+
+	es, err := hres.Rest()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(es) != 1 || es[0].Key != "/cached" {
+		t.Fatal("expected cached entries", es)
+	}
+
+	// underlying results are not read
+	r, ok := hres.res.NextSync()
+	if !ok || r.Key != "/a" {
+		t.Fatal("expected underlying results not to be read", r)
+	}
+}
+
+func TestBeforeRestShortCircuitEmpty(t *testing.T) {
+	// a cache hit with no entries
+	onBeforeRest := func(c *call.Call) ([]query.Entry, bool, error) {
+		return nil, true, nil
+	}
+
+	hres := newResults(t, WithBeforeRest(onBeforeRest))
+	defer hres.Close()
+
+	es, err := hres.Rest()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(es) != 0 {
+		t.Fatal("expected no entries", es)
+	}
+
+	// underlying results are not read
+	r, ok := hres.res.NextSync()
+	if !ok || r.Key != "/a" {
+		t.Fatal("expected underlying results not to be read", r)
+	}
+}
+
+func TestBeforeRestError(t *testing.T) {
+	onBeforeRest := func(c *call.Call) ([]query.Entry, bool, error) {
+		return nil, false, errSecret
+	}
+
+	hres := newResults(t, WithBeforeRest(onBeforeRest))
+	defer hres.Close()
+
+	_, err := hres.Rest()
+	var herr *call.HookError
+	if !errors.As(err, &herr) || herr.Hook != "BeforeRest" || !errors.Is(err, errSecret) {
+		t.Fatal("expected before rest error", err)
+	}
+}
+
+func TestBeforeNextSyncShortCircuit(t *testing.T) {
+	onBeforeNextSync := func(c *call.Call) (query.Result, bool, bool) {
+		return query.Result{Entry: query.Entry{Key: "/cached"}}, true, true
+	}
+
+	hres := newResults(t, WithBeforeNextSync(onBeforeNextSync))
+	defer hres.Close()
+
+	r, ok := hres.NextSync()
+	if !ok || r.Key != "/cached" {
+		t.Fatal("expected cached result", r)
+	}
+}
+
+func TestBeforeNextShortCircuit(t *testing.T) {
+	cached := make(chan query.Result, 1)
+	cached <- query.Result{Entry: query.Entry{Key: "/cached"}}
+	close(cached)
+
+	onBeforeNext := func(c *call.Call) <-chan query.Result {
+		return cached
+	}
+
+	hres := newResults(t, WithBeforeNext(onBeforeNext))
+	defer hres.Close()
+
+	var rs []query.Result
+	for r := range hres.Next() {
+		rs = append(rs, r)
+	}
+	if len(rs) != 1 || rs[0].Key != "/cached" {
+		t.Fatal("expected cached results", rs)
+	}
+}
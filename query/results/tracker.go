@@ -0,0 +1,89 @@
+package results
+
+import (
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Leak is query results that have not been closed or fully read.
+type Leak struct {
+	Query   query.Query
+	Created time.Time
+	// Stack is the stack trace of the goroutine that created the results.
+	Stack []byte
+}
+
+// LeakFunc is a handler for results that have not been closed or fully read
+// within the timeout of a Tracker.
+type LeakFunc func(Leak)
+
+// Tracker records where query results were created, so that results that are
+// never closed or fully read, which leaks resources in the datastore, can be
+// found. Results are tracked by a tracker when they are created WithTracker.
+type Tracker struct {
+	timeout time.Duration
+	onLeak  LeakFunc
+
+	mu   sync.Mutex
+	open map[*Results]*tracked
+}
+
+type tracked struct {
+	leak  Leak
+	timer *time.Timer
+}
+
+// NewTracker creates a new tracker. If `timeout` is not zero, `onLeak` is
+// called for results that are still open once it has elapsed since they were
+// created.
+func NewTracker(timeout time.Duration, onLeak LeakFunc) *Tracker {
+	return &Tracker{timeout: timeout, onLeak: onLeak, open: map[*Results]*tracked{}}
+}
+
+// Leaks returns the results that are currently open, i.e. have not been closed
+// or fully read, oldest first.
+func (t *Tracker) Leaks() []Leak {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	leaks := make([]Leak, 0, len(t.open))
+	for _, tr := range t.open {
+		leaks = append(leaks, tr.leak)
+	}
+	sort.Slice(leaks, func(i, j int) bool { return leaks[i].Created.Before(leaks[j].Created) })
+	return leaks
+}
+
+// track starts tracking the results.
+func (t *Tracker) track(hres *Results) {
+	tr := &tracked{leak: Leak{Query: hres.res.Query(), Created: time.Now(), Stack: debug.Stack()}}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.open[hres] = tr
+	if t.timeout > 0 && t.onLeak != nil {
+		tr.timer = time.AfterFunc(t.timeout, func() {
+			t.mu.Lock()
+			_, ok := t.open[hres]
+			t.mu.Unlock()
+			if ok {
+				t.onLeak(tr.leak)
+			}
+		})
+	}
+}
+
+// untrack stops tracking the results, it is a noop if they are not tracked.
+func (t *Tracker) untrack(hres *Results) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tr, ok := t.open[hres]; ok {
+		if tr.timer != nil {
+			tr.timer.Stop()
+		}
+		delete(t.open, hres)
+	}
+}
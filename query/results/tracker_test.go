@@ -0,0 +1,76 @@
+package results
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTrackerLeaks(t *testing.T) {
+	tr := NewTracker(0, nil)
+
+	closed := newResults(t, WithTracker(tr))
+	drained := newResults(t, WithTracker(tr))
+	rested := newResults(t, WithTracker(tr))
+	leaked := newResults(t, WithTracker(tr))
+	defer leaked.Close()
+
+	if len(tr.Leaks()) != 4 {
+		t.Fatal("expected open results to be tracked", len(tr.Leaks()))
+	}
+
+	closed.Close()
+
+	for range drained.Next() {
+	}
+
+	_, err := rested.Rest()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	// partially read
+	leaked.NextSync()
+
+	// the channel returned by Next is closed asynchronously
+	for i := 0; i < 100 && len(tr.Leaks()) > 1; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	leaks := tr.Leaks()
+	if len(leaks) != 1 {
+		t.Fatal("expected one leak", leaks)
+	}
+	if !bytes.Contains(leaks[0].Stack, []byte("TestTrackerLeaks")) {
+		t.Fatal("expected creation stack", string(leaks[0].Stack))
+	}
+}
+
+func TestTrackerTimeout(t *testing.T) {
+	leaks := make(chan Leak, 1)
+
+	tr := NewTracker(time.Millisecond, func(l Leak) {
+		leaks <- l
+	})
+
+	hres := newResults(t, WithTracker(tr))
+	defer hres.Close()
+
+	select {
+	case l := <-leaks:
+		if len(l.Query.Orders) != 1 {
+			t.Fatal("incorrect leaked query", l.Query)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected leak to be reported")
+	}
+
+	closed := newResults(t, WithTracker(tr))
+	closed.Close()
+
+	select {
+	case l := <-leaks:
+		t.Fatal("unexpected leak", l)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
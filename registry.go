@@ -0,0 +1,70 @@
+package hook
+
+// Registry is implemented by hooked datastores that allow hooks to be added
+// and removed at runtime, e.g. the datastores returned by Wrap.
+type Registry interface {
+	AddHook(options ...Option) (remove func(), err error)
+}
+
+// AddHook adds hooks to the datastore at runtime. The hooks are called after
+// any hooks that were already configured with the same priority and may be
+// ordered against existing groups with WithRunBefore or WithRunAfter. It
+// returns a function that removes the added hooks, or an error if any of the
+// options fail, the resulting set of hooks is invalid or cannot be ordered. It
+// is safe to call concurrently with other methods.
+func (hds *Datastore) AddHook(options ...Option) (func(), error) {
+	opts := Options{}
+	if err := opts.Apply(options...); err != nil {
+		return nil, err
+	}
+
+	hds.mu.Lock()
+	defer hds.mu.Unlock()
+
+	regs := append(hds.registrations[:len(hds.registrations):len(hds.registrations)], &opts)
+	hooks, err := resolve(regs, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := hooks.validate(); err != nil {
+		return nil, err
+	}
+	hooks.recoverPanics()
+	hds.registrations = regs
+	hds.hooks.Store(hooks)
+
+	return func() { hds.removeHook(&opts) }, nil
+}
+
+// removeHook removes previously added hooks, it is a noop if they have
+// already been removed.
+func (hds *Datastore) removeHook(opts *Options) {
+	hds.mu.Lock()
+	defer hds.mu.Unlock()
+
+	var regs []*Options
+	for _, r := range hds.registrations {
+		if r != opts {
+			regs = append(regs, r)
+		}
+	}
+	if len(regs) == len(hds.registrations) {
+		return
+	}
+	// constraints against removed groups no longer apply and removing
+	// groups cannot introduce a cycle, so this cannot fail.
+	hooks, _ := resolve(regs, true)
+	hooks.recoverPanics()
+	hds.registrations = regs
+	hds.hooks.Store(hooks)
+}
+
+// options returns the current snapshot of hooks, without locking.
+func (hds *Datastore) options() *Options {
+	return hds.hooks.Load().(*Options)
+}
+
+// AddHook adds hooks to the datastore at runtime, see Datastore.AddHook.
+func (bds *Batching) AddHook(options ...Option) (func(), error) {
+	return bds.hds.AddHook(options...)
+}
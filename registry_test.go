@@ -0,0 +1,111 @@
+package hook
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+func TestAddHook(t *testing.T) {
+	calls := 0
+
+	onAfterPut := func(c *call.Call, k datastore.Key, v []byte, err error) error {
+		calls++
+		return err
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	key := datastore.NewKey("test")
+	value := []byte("test")
+
+	remove, err := hds.AddHook(WithAfterPut(onAfterPut))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = hds.Put(key, value)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if calls != 1 {
+		t.Fatal("added hook not called")
+	}
+
+	remove()
+	remove()
+
+	err = hds.Put(key, value)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if calls != 1 {
+		t.Fatal("removed hook called")
+	}
+}
+
+func TestAddHookInvalid(t *testing.T) {
+	onBeforeGet := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
+		return k, nil
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, Exclusive(WithBeforeGet(onBeforeGet)))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	_, err = hds.AddHook(WithBeforeGet(onBeforeGet))
+	if err == nil {
+		t.Fatal("expected conflicting exclusive hook error")
+	}
+}
+
+func TestAddHookConcurrent(t *testing.T) {
+	onBeforePut := func(c *call.Call, k datastore.Key, v []byte) (datastore.Key, []byte, error) {
+		return k, v, nil
+	}
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bds, err := NewBatching(ds)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer bds.Close()
+
+	// ensure it implements Registry
+	var reg Registry = bds
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			remove, err := reg.AddHook(WithBeforePut(onBeforePut))
+			if err != nil {
+				t.Error("unexpected error", err)
+				return
+			}
+			remove()
+		}()
+		go func() {
+			defer wg.Done()
+			err := bds.Put(datastore.NewKey("test"), []byte("test"))
+			if err != nil {
+				t.Error("unexpected error", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
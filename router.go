@@ -0,0 +1,347 @@
+package hook
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/internal/hookerr"
+	"github.com/alanshaw/ipfs-hookds/internal/validate"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// routable are the hooks that can be attached to a route.
+var routable = map[string]bool{
+	"BeforeGet":     true,
+	"AfterGet":      true,
+	"BeforePut":     true,
+	"AfterPut":      true,
+	"BeforeDelete":  true,
+	"AfterDelete":   true,
+	"BeforeHas":     true,
+	"AfterHas":      true,
+	"BeforeGetSize": true,
+	"AfterGetSize":  true,
+	"BeforeQuery":   true,
+	"AfterQuery":    true,
+}
+
+// Router attaches sets of hooks to key prefixes or glob patterns, so that only
+// the hooks for the subtrees of the datastore a key belongs to are called for
+// it. It is attached to a datastore using WithRouter.
+type Router struct {
+	mu   sync.RWMutex
+	root routeNode
+	n    int
+}
+
+type route struct {
+	seq     int
+	options *Options
+}
+
+// routeNode is a node in the prefix tree of routes, keyed by key namespace.
+type routeNode struct {
+	routes   []route
+	children map[string]*routeNode
+	globs    []*globNode
+}
+
+type globNode struct {
+	pattern string
+	node    *routeNode
+}
+
+// NewRouter creates a new router with no routes.
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle attaches hooks to the keys matching `pattern`. A pattern is a key,
+// e.g. "/blocks", whose namespaces may be glob patterns as understood by
+// path.Match, e.g. "/ipns/*/records". It matches keys whose leading namespaces
+// match it, i.e. the key itself and all of it's descendants. Only Put, Get,
+// Delete, Has, GetSize and Query hooks may be attached. The hooks of all
+// matching routes are called in the order the routes were added.
+//
+// Query hooks are matched against the prefix of the query, so they are only
+// called for queries of the subtree of the route, e.g. a query with the prefix
+// "/" does not call the Query hooks of the route "/blocks", even though it
+// returns the entries under "/blocks". Hooks that must process every entry read
+// from a subtree, e.g. to decrypt or filter them, should be configured as
+// entry hooks (see results.WithEntry and WithQueryResults) that check the key
+// of the entry instead.
+func (r *Router) Handle(pattern string, options ...Option) error {
+	opts := Options{}
+	if err := opts.Apply(options...); err != nil {
+		return fmt.Errorf("hook route %q: %s", pattern, err)
+	}
+	if err := opts.validate(); err != nil {
+		return fmt.Errorf("hook route %q: %s", pattern, err)
+	}
+	for name, n := range validate.Counts(&opts) {
+		if n > 0 && !routable[name] {
+			return fmt.Errorf("hook route %q: %s hooks cannot be routed", pattern, name)
+		}
+	}
+	if len(opts.groups) > 0 || opts.BatchPropagation || opts.PanicRecovery {
+		return fmt.Errorf("hook route %q: only hooks can be routed", pattern)
+	}
+
+	var namespaces []string
+	if k := datastore.NewKey(pattern); !k.Equal(datastore.RawKey("/")) {
+		namespaces = k.Namespaces()
+	}
+	for _, ns := range namespaces {
+		if _, err := path.Match(ns, ""); err != nil {
+			return fmt.Errorf("hook route %q: %s", pattern, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	node := &r.root
+	for _, ns := range namespaces {
+		node = node.child(ns)
+	}
+	node.routes = append(node.routes, route{seq: r.n, options: &opts})
+	r.n++
+	return nil
+}
+
+// child returns the child node for the namespace `ns`, creating it if needed.
+func (n *routeNode) child(ns string) *routeNode {
+	if strings.ContainsAny(ns, `*?[\`) {
+		for _, g := range n.globs {
+			if g.pattern == ns {
+				return g.node
+			}
+		}
+		g := &globNode{pattern: ns, node: &routeNode{}}
+		n.globs = append(n.globs, g)
+		return g.node
+	}
+	if n.children == nil {
+		n.children = map[string]*routeNode{}
+	}
+	c, ok := n.children[ns]
+	if !ok {
+		c = &routeNode{}
+		n.children[ns] = c
+	}
+	return c
+}
+
+// lookup returns the options of the routes that match the key `k`, in the order
+// the routes were added.
+func (r *Router) lookup(k datastore.Key) []*Options {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	routes := r.root.routes[:len(r.root.routes):len(r.root.routes)]
+	nodes := []*routeNode{&r.root}
+	for _, ns := range k.Namespaces() {
+		var next []*routeNode
+		for _, n := range nodes {
+			if c, ok := n.children[ns]; ok {
+				next = append(next, c)
+			}
+			for _, g := range n.globs {
+				if ok, _ := path.Match(g.pattern, ns); ok {
+					next = append(next, g.node)
+				}
+			}
+		}
+		for _, n := range next {
+			routes = append(routes, n.routes...)
+		}
+		nodes = next
+	}
+
+	sort.Slice(routes, func(i, j int) bool { return routes[i].seq < routes[j].seq })
+	matched := make([]*Options, len(routes))
+	for i, rt := range routes {
+		matched[i] = rt.options
+	}
+	return matched
+}
+
+// match returns the options of the routes that match the key `k`. The routes
+// are matched once per call, so that the after hooks called are those of the
+// routes whose before hooks were called, even if a hook changes the key.
+func (r *Router) match(c *call.Call, k datastore.Key) []*Options {
+	if matched, ok := c.Value(r).([]*Options); ok {
+		return matched
+	}
+	matched := r.lookup(k)
+	c.Set(r, matched)
+	return matched
+}
+
+// WithRouter configures the hooks attached to the routes of `r` to be called
+// for the keys they match.
+func WithRouter(r *Router) Option {
+	return func(o *Options) error {
+		if r == nil {
+			return fmt.Errorf("nil router")
+		}
+		o.BeforeGet = append(o.BeforeGet, r.beforeGet)
+		o.AfterGet = append(o.AfterGet, r.afterGet)
+		o.BeforePut = append(o.BeforePut, r.beforePut)
+		o.AfterPut = append(o.AfterPut, r.afterPut)
+		o.BeforeDelete = append(o.BeforeDelete, r.beforeDelete)
+		o.AfterDelete = append(o.AfterDelete, r.afterDelete)
+		o.BeforeHas = append(o.BeforeHas, r.beforeHas)
+		o.AfterHas = append(o.AfterHas, r.afterHas)
+		o.BeforeGetSize = append(o.BeforeGetSize, r.beforeGetSize)
+		o.AfterGetSize = append(o.AfterGetSize, r.afterGetSize)
+		o.BeforeQuery = append(o.BeforeQuery, r.beforeQuery)
+		o.AfterQuery = append(o.AfterQuery, r.afterQuery)
+		return nil
+	}
+}
+
+func (r *Router) beforeGet(c *call.Call, key datastore.Key) (k datastore.Key, err error) {
+	k = key
+	for _, o := range r.match(c, key) {
+		for _, f := range o.BeforeGet {
+			if k, err = f(c, k); err != nil {
+				return k, hookerr.Wrap(c, "BeforeGet", f, key, nil, err)
+			}
+		}
+	}
+	return k, nil
+}
+
+func (r *Router) afterGet(c *call.Call, key datastore.Key, value []byte, err error) ([]byte, error) {
+	for _, o := range r.match(c, key) {
+		for _, f := range o.AfterGet {
+			prev := err
+			value, err = f(c, key, value, prev)
+			err = hookerr.Wrap(c, "AfterGet", f, key, prev, err)
+		}
+	}
+	return value, err
+}
+
+func (r *Router) beforePut(c *call.Call, key datastore.Key, value []byte) (k datastore.Key, v []byte, err error) {
+	k, v = key, value
+	for _, o := range r.match(c, key) {
+		for _, f := range o.BeforePut {
+			if k, v, err = f(c, k, v); err != nil {
+				return k, v, hookerr.Wrap(c, "BeforePut", f, key, nil, err)
+			}
+		}
+	}
+	return k, v, nil
+}
+
+func (r *Router) afterPut(c *call.Call, key datastore.Key, value []byte, err error) error {
+	for _, o := range r.match(c, key) {
+		for _, f := range o.AfterPut {
+			prev := err
+			err = f(c, key, value, prev)
+			err = hookerr.Wrap(c, "AfterPut", f, key, prev, err)
+		}
+	}
+	return err
+}
+
+func (r *Router) beforeDelete(c *call.Call, key datastore.Key) (k datastore.Key, err error) {
+	k = key
+	for _, o := range r.match(c, key) {
+		for _, f := range o.BeforeDelete {
+			if k, err = f(c, k); err != nil {
+				return k, hookerr.Wrap(c, "BeforeDelete", f, key, nil, err)
+			}
+		}
+	}
+	return k, nil
+}
+
+func (r *Router) afterDelete(c *call.Call, key datastore.Key, err error) error {
+	for _, o := range r.match(c, key) {
+		for _, f := range o.AfterDelete {
+			prev := err
+			err = f(c, key, prev)
+			err = hookerr.Wrap(c, "AfterDelete", f, key, prev, err)
+		}
+	}
+	return err
+}
+
+func (r *Router) beforeHas(c *call.Call, key datastore.Key) (k datastore.Key, err error) {
+	k = key
+	for _, o := range r.match(c, key) {
+		for _, f := range o.BeforeHas {
+			if k, err = f(c, k); err != nil {
+				return k, hookerr.Wrap(c, "BeforeHas", f, key, nil, err)
+			}
+		}
+	}
+	return k, nil
+}
+
+func (r *Router) afterHas(c *call.Call, key datastore.Key, exists bool, err error) (bool, error) {
+	for _, o := range r.match(c, key) {
+		for _, f := range o.AfterHas {
+			prev := err
+			exists, err = f(c, key, exists, prev)
+			err = hookerr.Wrap(c, "AfterHas", f, key, prev, err)
+		}
+	}
+	return exists, err
+}
+
+func (r *Router) beforeGetSize(c *call.Call, key datastore.Key) (k datastore.Key, err error) {
+	k = key
+	for _, o := range r.match(c, key) {
+		for _, f := range o.BeforeGetSize {
+			if k, err = f(c, k); err != nil {
+				return k, hookerr.Wrap(c, "BeforeGetSize", f, key, nil, err)
+			}
+		}
+	}
+	return k, nil
+}
+
+func (r *Router) afterGetSize(c *call.Call, key datastore.Key, size int, err error) (int, error) {
+	for _, o := range r.match(c, key) {
+		for _, f := range o.AfterGetSize {
+			prev := err
+			size, err = f(c, key, size, prev)
+			err = hookerr.Wrap(c, "AfterGetSize", f, key, prev, err)
+		}
+	}
+	return size, err
+}
+
+func (r *Router) beforeQuery(c *call.Call, q query.Query) (query.Query, error) {
+	prefix := datastore.NewKey(q.Prefix)
+	for _, o := range r.match(c, prefix) {
+		for _, f := range o.BeforeQuery {
+			var err error
+			if q, err = f(c, q); err != nil {
+				return q, hookerr.Wrap(c, "BeforeQuery", f, prefix, nil, err)
+			}
+		}
+	}
+	return q, nil
+}
+
+func (r *Router) afterQuery(c *call.Call, q query.Query, res query.Results, err error) (query.Results, error) {
+	prefix := datastore.NewKey(q.Prefix)
+	for _, o := range r.match(c, prefix) {
+		for _, f := range o.AfterQuery {
+			prev := err
+			res, err = f(c, q, res, prev)
+			err = hookerr.Wrap(c, "AfterQuery", f, prefix, prev, err)
+		}
+	}
+	return res, err
+}
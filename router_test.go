@@ -0,0 +1,164 @@
+package hook
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+func TestRouter(t *testing.T) {
+	var calls []string
+
+	onAfterPut := func(name string) AfterPutFunc {
+		return func(c *call.Call, k datastore.Key, v []byte, err error) error {
+			calls = append(calls, name+" "+k.String())
+			return err
+		}
+	}
+
+	r := NewRouter()
+	routes := []struct {
+		pattern string
+		name    string
+	}{
+		{"/blocks", "blocks"},
+		{"/ipns/*/records", "records"},
+		{"/", "all"},
+		{"/pins", "pins"},
+	}
+	for _, rt := range routes {
+		err := r.Handle(rt.pattern, WithAfterPut(onAfterPut(rt.name)))
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, WithRouter(r))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	keys := []string{"/blocks/QmA", "/ipns/k51/records/1", "/ipns/k51/other", "/blocksmith"}
+	for _, k := range keys {
+		err = hds.Put(datastore.NewKey(k), []byte("test"))
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+
+	expected := []string{
+		"blocks /blocks/QmA",
+		"all /blocks/QmA",
+		"records /ipns/k51/records/1",
+		"all /ipns/k51/records/1",
+		"all /ipns/k51/other",
+		"all /blocksmith",
+	}
+	if len(calls) != len(expected) {
+		t.Fatal("incorrect routed calls", calls)
+	}
+	for i, c := range expected {
+		if calls[i] != c {
+			t.Fatal("incorrect routed calls", calls)
+		}
+	}
+}
+
+func TestRouterBeforeError(t *testing.T) {
+	rejected := errors.New("rejected")
+
+	onBeforeGet := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
+		return k, rejected
+	}
+
+	r := NewRouter()
+	err := r.Handle("/private", WithBeforeGet(onBeforeGet))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	ds := datastore.NewMapDatastore()
+	hds, err := NewDatastore(ds, WithRouter(r))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	_, err = hds.Get(datastore.NewKey("/private/key"))
+
+	var herr *call.HookError
+	if !errors.As(err, &herr) || herr.Hook != "BeforeGet" || !errors.Is(err, rejected) {
+		t.Fatal("expected routed hook error", err)
+	}
+
+	_, err = hds.Get(datastore.NewKey("/public/key"))
+	if err != datastore.ErrNotFound {
+		t.Fatal("expected not found error", err)
+	}
+}
+
+func TestRouterQuery(t *testing.T) {
+	queried := false
+
+	onBeforeQuery := func(c *call.Call, q query.Query) (query.Query, error) {
+		queried = true
+		return q, nil
+	}
+
+	r := NewRouter()
+	err := r.Handle("/blocks", WithBeforeQuery(onBeforeQuery))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	hds, err := NewDatastore(datastore.NewMapDatastore(), WithRouter(r))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	_, err = hds.Query(query.Query{Prefix: "/pins"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if queried {
+		t.Fatal("unexpected routed query hook call")
+	}
+
+	_, err = hds.Query(query.Query{Prefix: "/blocks"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if !queried {
+		t.Fatal("routed query hook not called")
+	}
+}
+
+func TestRouterInvalid(t *testing.T) {
+	onBeforeSync := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
+		return k, nil
+	}
+
+	r := NewRouter()
+	err := r.Handle("/blocks", WithBeforeSync(onBeforeSync))
+	if err == nil {
+		t.Fatal("expected unroutable hook error")
+	}
+
+	err = r.Handle("/blocks/[", WithBeforePut(nil))
+	if err == nil {
+		t.Fatal("expected nil hook error")
+	}
+
+	err = r.Handle("/blocks/[")
+	if err == nil {
+		t.Fatal("expected bad pattern error")
+	}
+}
@@ -0,0 +1,28 @@
+package hook
+
+// ShortCircuit is an error that a before Get or before Has hook can return to
+// skip calling the wrapped datastore. The after hooks are called with the
+// result it carries, as if it had been returned by the wrapped datastore.
+//
+// To short circuit with an error (e.g. a negative lookup) a before hook can
+// simply return that error, e.g. datastore.ErrNotFound.
+type ShortCircuit struct {
+	Value  []byte
+	Exists bool
+}
+
+func (sc *ShortCircuit) Error() string {
+	return "hook: short circuit"
+}
+
+// ShortCircuitGet creates an error for a before Get hook that skips the wrapped
+// datastore and results in `value`.
+func ShortCircuitGet(value []byte) error {
+	return &ShortCircuit{Value: value, Exists: true}
+}
+
+// ShortCircuitHas creates an error for a before Has hook that skips the wrapped
+// datastore and results in `exists`.
+func ShortCircuitHas(exists bool) error {
+	return &ShortCircuit{Exists: exists}
+}
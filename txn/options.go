@@ -0,0 +1,324 @@
+package txn
+
+import (
+	"fmt"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/internal/validate"
+	"github.com/alanshaw/ipfs-hookds/query/results"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// BeforeGetFunc is a handler for the before Get hook
+// Returning an error aborts the Get and the error is passed to the after hooks.
+type BeforeGetFunc func(*call.Call, datastore.Key) (datastore.Key, error)
+
+// AfterGetFunc is a handler for the after Get hook
+type AfterGetFunc func(*call.Call, datastore.Key, []byte, error) ([]byte, error)
+
+// BeforeHasFunc is a handler for the before Has hook
+// Returning an error aborts the Has and the error is passed to the after hooks.
+type BeforeHasFunc func(*call.Call, datastore.Key) (datastore.Key, error)
+
+// AfterHasFunc is a handler for the after Has hook
+type AfterHasFunc func(*call.Call, datastore.Key, bool, error) (bool, error)
+
+// BeforeGetSizeFunc is a handler for the before GetSize hook
+// Returning an error aborts the GetSize and the error is passed to the after hooks.
+type BeforeGetSizeFunc func(*call.Call, datastore.Key) (datastore.Key, error)
+
+// AfterGetSizeFunc is a handler for the after GetSize hook
+type AfterGetSizeFunc func(*call.Call, datastore.Key, int, error) (int, error)
+
+// BeforeQueryFunc is a handler for the before Query hook
+// Returning an error aborts the Query and the error is passed to the after hooks.
+type BeforeQueryFunc func(*call.Call, query.Query) (query.Query, error)
+
+// AfterQueryFunc is a handler for the after Query hook
+type AfterQueryFunc func(*call.Call, query.Query, query.Results, error) (query.Results, error)
+
+// BeforePutFunc is a handler for the before Put hook
+// Returning an error aborts the Put and the error is passed to the after hooks.
+type BeforePutFunc func(*call.Call, datastore.Key, []byte) (datastore.Key, []byte, error)
+
+// AfterPutFunc is a handler for the after Put hook
+type AfterPutFunc func(*call.Call, datastore.Key, []byte, error) error
+
+// BeforeDeleteFunc is a handler for the before Delete hook
+// Returning an error aborts the Delete and the error is passed to the after hooks.
+type BeforeDeleteFunc func(*call.Call, datastore.Key) (datastore.Key, error)
+
+// AfterDeleteFunc is a handler for the after Delete hook
+type AfterDeleteFunc func(*call.Call, datastore.Key, error) error
+
+// BeforeCommitFunc is a handler for the before Commit hook
+// Returning an error aborts the Commit and the error is passed to the after hooks.
+type BeforeCommitFunc func(*call.Call) error
+
+// AfterCommitFunc is a handler for the after Commit hook
+type AfterCommitFunc func(*call.Call, error) error
+
+// BeforeDiscardFunc is a handler for the before Discard hook
+type BeforeDiscardFunc func(*call.Call)
+
+// AfterDiscardFunc is a handler for the after Discard hook
+type AfterDiscardFunc func(*call.Call)
+
+// ValidateFunc validates options once all options have been applied.
+type ValidateFunc func(*Options) error
+
+// Options are transaction options. Hooks configured for the same method are
+// called in order, each receiving the output of the previous hook.
+type Options struct {
+	BeforeGet     []BeforeGetFunc
+	AfterGet      []AfterGetFunc
+	BeforeHas     []BeforeHasFunc
+	AfterHas      []AfterHasFunc
+	BeforeGetSize []BeforeGetSizeFunc
+	AfterGetSize  []AfterGetSizeFunc
+	BeforeQuery   []BeforeQueryFunc
+	AfterQuery    []AfterQueryFunc
+	BeforePut     []BeforePutFunc
+	AfterPut      []AfterPutFunc
+	BeforeDelete  []BeforeDeleteFunc
+	AfterDelete   []AfterDeleteFunc
+	BeforeCommit  []BeforeCommitFunc
+	AfterCommit   []AfterCommitFunc
+	BeforeDiscard []BeforeDiscardFunc
+	AfterDiscard  []AfterDiscardFunc
+
+	Interceptors []call.Interceptor
+
+	// ResultsOptions are applied to the results of every Query, e.g. results
+	// hooks, a results.Tracker or iteration limits.
+	ResultsOptions []results.Option
+
+	validators []validate.Func
+}
+
+// Option is the transaction option type.
+type Option func(*Options) error
+
+// Apply applies the given options to this Option.
+func (o *Options) Apply(opts ...Option) error {
+	for i, opt := range opts {
+		if err := opt(o); err != nil {
+			return fmt.Errorf("transaction option %d failed: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// validate checks that no hooks are nil and calls the configured validators.
+func (o *Options) validate() error {
+	if err := results.Validate(o.ResultsOptions...); err != nil {
+		return fmt.Errorf("transaction options invalid: %s", err)
+	}
+	return validate.Check("transaction options", o, o.validators)
+}
+
+// WithValidator configures a function that validates the options once all
+// options have been applied, allowing bad combinations to be rejected.
+func WithValidator(f ValidateFunc) Option {
+	return func(o *Options) error {
+		o.validators = append(o.validators, func(o interface{}) error {
+			return f(o.(*Options))
+		})
+		return nil
+	}
+}
+
+// Exclusive configures the hooks added by `opt` to be exclusive. Options are
+// invalid if any other hooks are configured for the same methods.
+func Exclusive(opt Option) Option {
+	return func(o *Options) error {
+		check, err := validate.Exclusive(o, func() error { return opt(o) })
+		if err != nil {
+			return err
+		}
+		o.validators = append(o.validators, check)
+		return nil
+	}
+}
+
+// WithBeforeGet configures a hook that is called _before_ Get.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeGet(f BeforeGetFunc) Option {
+	return func(o *Options) error {
+		o.BeforeGet = append(o.BeforeGet, f)
+		return nil
+	}
+}
+
+// WithAfterGet configures a hook that is called _after_ Get.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterGet(f AfterGetFunc) Option {
+	return func(o *Options) error {
+		o.AfterGet = append(o.AfterGet, f)
+		return nil
+	}
+}
+
+// WithBeforeHas configures a hook that is called _before_ Has.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeHas(f BeforeHasFunc) Option {
+	return func(o *Options) error {
+		o.BeforeHas = append(o.BeforeHas, f)
+		return nil
+	}
+}
+
+// WithAfterHas configures a hook that is called _after_ Has.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterHas(f AfterHasFunc) Option {
+	return func(o *Options) error {
+		o.AfterHas = append(o.AfterHas, f)
+		return nil
+	}
+}
+
+// WithBeforeGetSize configures a hook that is called _before_ GetSize.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeGetSize(f BeforeGetSizeFunc) Option {
+	return func(o *Options) error {
+		o.BeforeGetSize = append(o.BeforeGetSize, f)
+		return nil
+	}
+}
+
+// WithAfterGetSize configures a hook that is called _after_ GetSize.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterGetSize(f AfterGetSizeFunc) Option {
+	return func(o *Options) error {
+		o.AfterGetSize = append(o.AfterGetSize, f)
+		return nil
+	}
+}
+
+// WithBeforeQuery configures a hook that is called _before_ Query.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeQuery(f BeforeQueryFunc) Option {
+	return func(o *Options) error {
+		o.BeforeQuery = append(o.BeforeQuery, f)
+		return nil
+	}
+}
+
+// WithAfterQuery configures a hook that is called _after_ Query.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterQuery(f AfterQueryFunc) Option {
+	return func(o *Options) error {
+		o.AfterQuery = append(o.AfterQuery, f)
+		return nil
+	}
+}
+
+// WithBeforePut configures a hook that is called _before_ Put.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforePut(f BeforePutFunc) Option {
+	return func(o *Options) error {
+		o.BeforePut = append(o.BeforePut, f)
+		return nil
+	}
+}
+
+// WithAfterPut configures a hook that is called _after_ Put.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterPut(f AfterPutFunc) Option {
+	return func(o *Options) error {
+		o.AfterPut = append(o.AfterPut, f)
+		return nil
+	}
+}
+
+// WithBeforeDelete configures a hook that is called _before_ Delete.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeDelete(f BeforeDeleteFunc) Option {
+	return func(o *Options) error {
+		o.BeforeDelete = append(o.BeforeDelete, f)
+		return nil
+	}
+}
+
+// WithAfterDelete configures a hook that is called _after_ Delete.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterDelete(f AfterDeleteFunc) Option {
+	return func(o *Options) error {
+		o.AfterDelete = append(o.AfterDelete, f)
+		return nil
+	}
+}
+
+// WithBeforeCommit configures a hook that is called _before_ Commit.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeCommit(f BeforeCommitFunc) Option {
+	return func(o *Options) error {
+		o.BeforeCommit = append(o.BeforeCommit, f)
+		return nil
+	}
+}
+
+// WithAfterCommit configures a hook that is called _after_ Commit.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterCommit(f AfterCommitFunc) Option {
+	return func(o *Options) error {
+		o.AfterCommit = append(o.AfterCommit, f)
+		return nil
+	}
+}
+
+// WithBeforeDiscard configures a hook that is called _before_ Discard.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithBeforeDiscard(f BeforeDiscardFunc) Option {
+	return func(o *Options) error {
+		o.BeforeDiscard = append(o.BeforeDiscard, f)
+		return nil
+	}
+}
+
+// WithAfterDiscard configures a hook that is called _after_ Discard.
+// Multiple hooks are called in the order they were configured.
+// Defaults to noop.
+func WithAfterDiscard(f AfterDiscardFunc) Option {
+	return func(o *Options) error {
+		o.AfterDiscard = append(o.AfterDiscard, f)
+		return nil
+	}
+}
+
+// WithInterceptor configures middleware that is called around every operation,
+// including the before and after hooks.
+// Multiple interceptors are called in the order they were configured, the
+// first being the outermost.
+func WithInterceptor(i call.Interceptor) Option {
+	return func(o *Options) error {
+		o.Interceptors = append(o.Interceptors, i)
+		return nil
+	}
+}
+
+// WithQueryResults configures options that are applied to the results of
+// every Query, e.g. results hooks, a results.Tracker or default iteration
+// limits such as results.WithMaxEntries.
+func WithQueryResults(options ...results.Option) Option {
+	return func(o *Options) error {
+		o.ResultsOptions = append(o.ResultsOptions, options...)
+		return nil
+	}
+}
@@ -0,0 +1,243 @@
+package txn
+
+import (
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/internal/hookerr"
+	"github.com/alanshaw/ipfs-hookds/query/results"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Txn is a group of reads and writes that are performed (Committed) atomically.
+type Txn struct {
+	txn     datastore.Txn
+	options Options
+}
+
+// NewTxn wraps a datastore.Txn and adds optional before and after hooks into it's methods.
+// It returns an error if any of the options fail or are invalid.
+func NewTxn(txn datastore.Txn, options ...Option) (*Txn, error) {
+	opts := Options{}
+	if err := opts.Apply(options...); err != nil {
+		return nil, err
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	return &Txn{txn: txn, options: opts}, nil
+}
+
+// Get retrieves the object `value` named by `key`, it calls OnBeforeGet and OnAfterGet hooks.
+func (htx *Txn) Get(key datastore.Key) ([]byte, error) {
+	op := call.Op{Call: call.New("Txn.Get"), Key: key}
+	result := call.Invoke(htx.options.Interceptors, op, func(op call.Op) call.Result {
+		c, key := op.Call, op.Key
+		var err error
+		for _, f := range htx.options.BeforeGet {
+			if key, err = f(c, key); err != nil {
+				err = hookerr.Wrap(c, "BeforeGet", f, op.Key, nil, err)
+				break
+			}
+		}
+		var value []byte
+		if err == nil {
+			value, err = htx.txn.Get(key)
+		}
+		for _, f := range htx.options.AfterGet {
+			prev := err
+			value, err = f(c, key, value, prev)
+			err = hookerr.Wrap(c, "AfterGet", f, op.Key, prev, err)
+		}
+		return call.Result{Value: value, Err: err}
+	})
+	return result.Value, result.Err
+}
+
+// Has returns whether the `key` is mapped to a `value`, it calls OnBeforeHas and OnAfterHas hooks.
+func (htx *Txn) Has(key datastore.Key) (bool, error) {
+	op := call.Op{Call: call.New("Txn.Has"), Key: key}
+	result := call.Invoke(htx.options.Interceptors, op, func(op call.Op) call.Result {
+		c, key := op.Call, op.Key
+		var err error
+		for _, f := range htx.options.BeforeHas {
+			if key, err = f(c, key); err != nil {
+				err = hookerr.Wrap(c, "BeforeHas", f, op.Key, nil, err)
+				break
+			}
+		}
+		var exists bool
+		if err == nil {
+			exists, err = htx.txn.Has(key)
+		}
+		for _, f := range htx.options.AfterHas {
+			prev := err
+			exists, err = f(c, key, exists, prev)
+			err = hookerr.Wrap(c, "AfterHas", f, op.Key, prev, err)
+		}
+		return call.Result{Exists: exists, Err: err}
+	})
+	return result.Exists, result.Err
+}
+
+// GetSize returns the size of the `value` named by `key`, it calls OnBeforeGetSize and OnAfterGetSize hooks.
+func (htx *Txn) GetSize(key datastore.Key) (int, error) {
+	op := call.Op{Call: call.New("Txn.GetSize"), Key: key}
+	result := call.Invoke(htx.options.Interceptors, op, func(op call.Op) call.Result {
+		c, key := op.Call, op.Key
+		var err error
+		for _, f := range htx.options.BeforeGetSize {
+			if key, err = f(c, key); err != nil {
+				err = hookerr.Wrap(c, "BeforeGetSize", f, op.Key, nil, err)
+				break
+			}
+		}
+		var size int
+		if err == nil {
+			size, err = htx.txn.GetSize(key)
+		}
+		for _, f := range htx.options.AfterGetSize {
+			prev := err
+			size, err = f(c, key, size, prev)
+			err = hookerr.Wrap(c, "AfterGetSize", f, op.Key, prev, err)
+		}
+		return call.Result{Size: size, Err: err}
+	})
+	return result.Size, result.Err
+}
+
+// Query searches the transaction and returns a query result, it calls OnBeforeQuery and OnAfterQuery hooks.
+func (htx *Txn) Query(q query.Query) (query.Results, error) {
+	op := call.Op{Call: call.New("Txn.Query"), Query: q}
+	result := call.Invoke(htx.options.Interceptors, op, func(op call.Op) call.Result {
+		c, q := op.Call, op.Query
+		var err error
+		for _, f := range htx.options.BeforeQuery {
+			if q, err = f(c, q); err != nil {
+				err = hookerr.Wrap(c, "BeforeQuery", f, datastore.Key{}, nil, err)
+				break
+			}
+		}
+		var res query.Results
+		if err == nil {
+			res, err = htx.txn.Query(q)
+		}
+		if err == nil && (len(htx.options.Interceptors) > 0 || len(htx.options.ResultsOptions) > 0) {
+			res, err = htx.hookResults(res)
+		}
+		for _, f := range htx.options.AfterQuery {
+			prev := err
+			res, err = f(c, q, res, prev)
+			err = hookerr.Wrap(c, "AfterQuery", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{Results: res, Err: err}
+	})
+	return result.Results, result.Err
+}
+
+// Put stores the object `value` named by `key`, it calls OnBeforePut and OnAfterPut hooks.
+func (htx *Txn) Put(key datastore.Key, value []byte) error {
+	op := call.Op{Call: call.New("Txn.Put"), Key: key, Value: value}
+	result := call.Invoke(htx.options.Interceptors, op, func(op call.Op) call.Result {
+		c, key, value := op.Call, op.Key, op.Value
+		var err error
+		for _, f := range htx.options.BeforePut {
+			if key, value, err = f(c, key, value); err != nil {
+				err = hookerr.Wrap(c, "BeforePut", f, op.Key, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			err = htx.txn.Put(key, value)
+		}
+		for _, f := range htx.options.AfterPut {
+			prev := err
+			err = f(c, key, value, prev)
+			err = hookerr.Wrap(c, "AfterPut", f, op.Key, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
+}
+
+// Delete removes the value for given `key`, it calls OnBeforeDelete and OnAfterDelete hooks.
+func (htx *Txn) Delete(key datastore.Key) error {
+	op := call.Op{Call: call.New("Txn.Delete"), Key: key}
+	result := call.Invoke(htx.options.Interceptors, op, func(op call.Op) call.Result {
+		c, key := op.Call, op.Key
+		var err error
+		for _, f := range htx.options.BeforeDelete {
+			if key, err = f(c, key); err != nil {
+				err = hookerr.Wrap(c, "BeforeDelete", f, op.Key, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			err = htx.txn.Delete(key)
+		}
+		for _, f := range htx.options.AfterDelete {
+			prev := err
+			err = f(c, key, prev)
+			err = hookerr.Wrap(c, "AfterDelete", f, op.Key, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
+}
+
+// Commit finalizes the transaction, it calls OnBeforeCommit and OnAfterCommit hooks.
+func (htx *Txn) Commit() error {
+	op := call.Op{Call: call.New("Txn.Commit")}
+	result := call.Invoke(htx.options.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		var err error
+		for _, f := range htx.options.BeforeCommit {
+			if err = f(c); err != nil {
+				err = hookerr.Wrap(c, "BeforeCommit", f, datastore.Key{}, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			err = htx.txn.Commit()
+		}
+		for _, f := range htx.options.AfterCommit {
+			prev := err
+			err = f(c, prev)
+			err = hookerr.Wrap(c, "AfterCommit", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
+}
+
+// Discard throws away changes recorded in the transaction, it calls OnBeforeDiscard and OnAfterDiscard hooks.
+func (htx *Txn) Discard() {
+	op := call.Op{Call: call.New("Txn.Discard")}
+	call.Invoke(htx.options.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		for _, f := range htx.options.BeforeDiscard {
+			f(c)
+		}
+		htx.txn.Discard()
+		for _, f := range htx.options.AfterDiscard {
+			f(c)
+		}
+		return call.Result{}
+	})
+}
+
+// hookResults wraps query results so that the interceptors of the transaction
+// are called for it's operations and the results options are applied to it.
+// The results are closed if the options fail.
+func (htx *Txn) hookResults(res query.Results) (query.Results, error) {
+	var options []results.Option
+	for _, i := range htx.options.Interceptors {
+		options = append(options, results.WithInterceptor(i))
+	}
+	options = append(options, htx.options.ResultsOptions...)
+	hres, err := results.NewResults(res, options...)
+	if err != nil {
+		res.Close()
+		return nil, err
+	}
+	return hres, nil
+}
@@ -0,0 +1,248 @@
+package txn
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/query/results"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// testTxn is a simple transaction that reads from a datastore and writes to a
+// batch of the same datastore.
+type testTxn struct {
+	datastore.Batch
+	ds        datastore.Batching
+	discarded bool
+}
+
+func newTestTxn(t *testing.T, ds datastore.Batching) *testTxn {
+	bch, err := ds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	return &testTxn{Batch: bch, ds: ds}
+}
+
+func (tx *testTxn) Get(key datastore.Key) ([]byte, error) {
+	return tx.ds.Get(key)
+}
+
+func (tx *testTxn) Has(key datastore.Key) (bool, error) {
+	return tx.ds.Has(key)
+}
+
+func (tx *testTxn) GetSize(key datastore.Key) (int, error) {
+	return tx.ds.GetSize(key)
+}
+
+func (tx *testTxn) Query(q query.Query) (query.Results, error) {
+	return tx.ds.Query(q)
+}
+
+func (tx *testTxn) Discard() {
+	tx.discarded = true
+}
+
+func TestIsTxn(t *testing.T) {
+	ds := datastore.NewMapDatastore()
+	defer ds.Close()
+
+	tx, err := NewTxn(newTestTxn(t, ds))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	// ensure it implements datastore.Txn
+	var htx datastore.Txn = tx
+
+	err = htx.Put(datastore.NewKey("test"), []byte("test"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = htx.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+func TestTxnHookPut(t *testing.T) {
+	beforeHookCalled := false
+	afterHookCalled := false
+
+	key := datastore.NewKey("test")
+	value := []byte("test")
+
+	onBeforePut := func(c *call.Call, k datastore.Key, v []byte) (datastore.Key, []byte, error) {
+		if k != key {
+			t.Fatal("incorrect key")
+		}
+		if bytes.Compare(v, value) != 0 {
+			t.Fatal("incorrect value")
+		}
+		beforeHookCalled = true
+		return k, v, nil
+	}
+
+	onAfterPut := func(c *call.Call, k datastore.Key, v []byte, err error) error {
+		afterHookCalled = true
+		return err
+	}
+
+	ds := datastore.NewMapDatastore()
+	defer ds.Close()
+
+	htx, err := NewTxn(newTestTxn(t, ds), WithBeforePut(onBeforePut), WithAfterPut(onAfterPut))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = htx.Put(key, value)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = htx.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if !beforeHookCalled {
+		t.Fatal("before hook not called")
+	}
+
+	if !afterHookCalled {
+		t.Fatal("after hook not called")
+	}
+}
+
+func TestTxnHookGet(t *testing.T) {
+	beforeHookCalled := false
+	afterHookCalled := false
+
+	key := datastore.NewKey("test")
+	value := []byte("test")
+
+	onBeforeGet := func(c *call.Call, k datastore.Key) (datastore.Key, error) {
+		if k != key {
+			t.Fatal("incorrect key")
+		}
+		beforeHookCalled = true
+		return k, nil
+	}
+
+	onAfterGet := func(c *call.Call, k datastore.Key, v []byte, err error) ([]byte, error) {
+		if bytes.Compare(v, value) != 0 {
+			t.Fatal("incorrect value")
+		}
+		afterHookCalled = true
+		return v, err
+	}
+
+	ds := datastore.NewMapDatastore()
+	defer ds.Close()
+
+	err := ds.Put(key, value)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	htx, err := NewTxn(newTestTxn(t, ds), WithBeforeGet(onBeforeGet), WithAfterGet(onAfterGet))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	v, err := htx.Get(key)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if bytes.Compare(v, value) != 0 {
+		t.Fatal("incorrect value")
+	}
+
+	if !beforeHookCalled {
+		t.Fatal("before hook not called")
+	}
+
+	if !afterHookCalled {
+		t.Fatal("after hook not called")
+	}
+}
+
+func TestTxnHookDiscard(t *testing.T) {
+	beforeHookCalled := false
+	afterHookCalled := false
+
+	onBeforeDiscard := func(c *call.Call) {
+		beforeHookCalled = true
+	}
+
+	onAfterDiscard := func(c *call.Call) {
+		afterHookCalled = true
+	}
+
+	ds := datastore.NewMapDatastore()
+	defer ds.Close()
+
+	tx := newTestTxn(t, ds)
+	htx, err := NewTxn(tx, WithBeforeDiscard(onBeforeDiscard), WithAfterDiscard(onAfterDiscard))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	htx.Discard()
+
+	if !tx.discarded {
+		t.Fatal("transaction not discarded")
+	}
+
+	if !beforeHookCalled {
+		t.Fatal("before hook not called")
+	}
+
+	if !afterHookCalled {
+		t.Fatal("after hook not called")
+	}
+}
+
+func TestTxnQueryResults(t *testing.T) {
+	var ops []string
+	interceptor := func(op call.Op, next call.Handler) call.Result {
+		ops = append(ops, op.Call.Op())
+		return next(op)
+	}
+
+	ds := datastore.NewMapDatastore()
+	defer ds.Close()
+
+	for _, k := range []string{"/a", "/b"} {
+		if err := ds.Put(datastore.NewKey(k), []byte(k)); err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+
+	htx, err := NewTxn(newTestTxn(t, ds), WithInterceptor(interceptor), WithQueryResults(results.WithMaxEntries(1)))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	res, err := htx.Query(query.Query{})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	_, err = res.Rest()
+	var lerr *results.LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != results.LimitEntries {
+		t.Fatal("expected max entries error", err)
+	}
+
+	if len(ops) != 2 || ops[0] != "Txn.Query" || ops[1] != "Results.Rest" {
+		t.Fatal("incorrect intercepted operations", ops)
+	}
+}
@@ -0,0 +1,285 @@
+package hook
+
+import (
+	"sync"
+
+	"github.com/ipfs/go-datastore"
+)
+
+// ChangeType is the type of a change to the datastore.
+type ChangeType int
+
+const (
+	// ChangePut is a value being put.
+	ChangePut ChangeType = iota
+	// ChangeDelete is a value being deleted.
+	ChangeDelete
+)
+
+func (t ChangeType) String() string {
+	if t == ChangeDelete {
+		return "delete"
+	}
+	return "put"
+}
+
+// Change is a successful mutation of the datastore.
+type Change struct {
+	Type ChangeType
+	Key  datastore.Key
+	// Value is the value that was put, if the watcher was created
+	// WithWatchValues. It must not be modified.
+	Value []byte
+	// Seq is the sequence number of the change. Sequence numbers increase by
+	// one for every change to the datastore, so gaps indicate changes that
+	// were not matched by the watcher or were dropped.
+	Seq uint64
+}
+
+// Watchable is implemented by hooked datastores that can be watched for
+// changes, e.g. the datastores returned by Wrap.
+type Watchable interface {
+	Watch(prefix datastore.Key, options ...WatchOption) *Watcher
+}
+
+type watchOptions struct {
+	values bool
+	buffer int
+}
+
+// WatchOption is a Watch option.
+type WatchOption func(*watchOptions)
+
+// WithWatchValues causes the values that were put to be included in changes.
+func WithWatchValues() WatchOption {
+	return func(o *watchOptions) {
+		o.values = true
+	}
+}
+
+// WithWatchBuffer sets the number of changes buffered for the watcher before
+// changes are dropped. Negative values are treated as zero. Defaults to 64.
+func WithWatchBuffer(n int) WatchOption {
+	return func(o *watchOptions) {
+		if n < 0 {
+			n = 0
+		}
+		o.buffer = n
+	}
+}
+
+// Watcher receives the changes made to keys under a prefix.
+type Watcher struct {
+	hds     *Datastore
+	prefix  datastore.Key
+	values  bool
+	changes chan Change
+	dropped uint64
+	closed  bool
+}
+
+// Changes returns the channel changes are sent on. It is closed when the
+// watcher or the datastore is closed.
+func (w *Watcher) Changes() <-chan Change {
+	return w.changes
+}
+
+// Dropped returns the number of changes that were dropped because the buffer of
+// the watcher was full.
+func (w *Watcher) Dropped() uint64 {
+	w.hds.watchMu.Lock()
+	defer w.hds.watchMu.Unlock()
+	return w.dropped
+}
+
+// Close stops the watcher and closes it's changes channel.
+func (w *Watcher) Close() {
+	w.hds.watchMu.Lock()
+	defer w.hds.watchMu.Unlock()
+	w.close()
+}
+
+func (w *Watcher) close() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	delete(w.hds.watchers, w)
+	close(w.changes)
+}
+
+// Watch returns a watcher for successful Put (and PutWithTTL) and Delete calls
+// for `prefix` and the keys under it, including those made by batches created
+// by Batching.Batch and transactions created by the NewTransaction method of
+// wrapped datastores, which are sent when the batch or transaction is
+// committed. Writers are never blocked by the watcher, when it's buffer is full
+// changes are dropped. Watchers created after the datastore has been closed are
+// already closed.
+func (hds *Datastore) Watch(prefix datastore.Key, options ...WatchOption) *Watcher {
+	opts := watchOptions{buffer: 64}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	w := &Watcher{
+		hds:     hds,
+		prefix:  prefix,
+		values:  opts.values,
+		changes: make(chan Change, opts.buffer),
+	}
+
+	hds.watchMu.Lock()
+	defer hds.watchMu.Unlock()
+	if hds.watchesClosed {
+		w.close()
+		return w
+	}
+	if hds.watchers == nil {
+		hds.watchers = map[*Watcher]struct{}{}
+	}
+	hds.watchers[w] = struct{}{}
+	return w
+}
+
+// Watch returns a watcher for changes to keys under `prefix`, see Datastore.Watch.
+func (bds *Batching) Watch(prefix datastore.Key, options ...WatchOption) *Watcher {
+	return bds.hds.Watch(prefix, options...)
+}
+
+// publish assigns sequence numbers to the changes and sends them to the
+// watchers that match them.
+func (hds *Datastore) publish(changes ...Change) {
+	hds.watchMu.Lock()
+	defer hds.watchMu.Unlock()
+	for _, c := range changes {
+		hds.seq++
+		c.Seq = hds.seq
+		for w := range hds.watchers {
+			if !w.prefix.Equal(c.Key) && !w.prefix.IsAncestorOf(c.Key) {
+				continue
+			}
+			wc := c
+			if !w.values {
+				wc.Value = nil
+			}
+			select {
+			case w.changes <- wc:
+			default:
+				w.dropped++
+			}
+		}
+	}
+}
+
+// closeWatchers closes all watchers and those created later.
+func (hds *Datastore) closeWatchers() {
+	hds.watchMu.Lock()
+	defer hds.watchMu.Unlock()
+	hds.watchesClosed = true
+	for w := range hds.watchers {
+		w.close()
+	}
+}
+
+// pendingChanges are the changes of a batch or transaction, that are published
+// when it is committed.
+type pendingChanges struct {
+	hds *Datastore
+
+	mu      sync.Mutex
+	changes []Change
+}
+
+func (p *pendingChanges) add(c Change) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.changes = append(p.changes, c)
+}
+
+func (p *pendingChanges) publish() {
+	p.mu.Lock()
+	changes := p.changes
+	p.changes = nil
+	p.mu.Unlock()
+	p.hds.publish(changes...)
+}
+
+func (p *pendingChanges) discard() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.changes = nil
+}
+
+// watchBatch is a batch that publishes it's changes when it is committed. It
+// records changes even if there are no watchers, as watchers may be created
+// before the batch is committed.
+type watchBatch struct {
+	datastore.Batch
+	pending pendingChanges
+}
+
+func newWatchBatch(hds *Datastore, bch datastore.Batch) *watchBatch {
+	return &watchBatch{Batch: bch, pending: pendingChanges{hds: hds}}
+}
+
+func (b *watchBatch) Put(key datastore.Key, value []byte) error {
+	err := b.Batch.Put(key, value)
+	if err == nil {
+		b.pending.add(Change{Type: ChangePut, Key: key, Value: value})
+	}
+	return err
+}
+
+func (b *watchBatch) Delete(key datastore.Key) error {
+	err := b.Batch.Delete(key)
+	if err == nil {
+		b.pending.add(Change{Type: ChangeDelete, Key: key})
+	}
+	return err
+}
+
+func (b *watchBatch) Commit() error {
+	err := b.Batch.Commit()
+	if err == nil {
+		b.pending.publish()
+	}
+	return err
+}
+
+// watchTxn is a transaction that publishes it's changes when it is committed.
+type watchTxn struct {
+	datastore.Txn
+	pending pendingChanges
+}
+
+func newWatchTxn(hds *Datastore, tx datastore.Txn) *watchTxn {
+	return &watchTxn{Txn: tx, pending: pendingChanges{hds: hds}}
+}
+
+func (tx *watchTxn) Put(key datastore.Key, value []byte) error {
+	err := tx.Txn.Put(key, value)
+	if err == nil {
+		tx.pending.add(Change{Type: ChangePut, Key: key, Value: value})
+	}
+	return err
+}
+
+func (tx *watchTxn) Delete(key datastore.Key) error {
+	err := tx.Txn.Delete(key)
+	if err == nil {
+		tx.pending.add(Change{Type: ChangeDelete, Key: key})
+	}
+	return err
+}
+
+func (tx *watchTxn) Commit() error {
+	err := tx.Txn.Commit()
+	if err == nil {
+		tx.pending.publish()
+	}
+	return err
+}
+
+func (tx *watchTxn) Discard() {
+	tx.Txn.Discard()
+	tx.pending.discard()
+}
@@ -0,0 +1,224 @@
+package hook
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+)
+
+func TestWatch(t *testing.T) {
+	hds, err := NewDatastore(datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	w := hds.Watch(datastore.NewKey("/blocks"), WithWatchValues())
+
+	err = hds.Put(datastore.NewKey("/pins/a"), []byte("pin"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = hds.Put(datastore.NewKey("/blocks/a"), []byte("block"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = hds.Delete(datastore.NewKey("/blocks/a"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	c := <-w.Changes()
+	if c.Type != ChangePut || c.Key.String() != "/blocks/a" || string(c.Value) != "block" || c.Seq != 2 {
+		t.Fatal("incorrect change", c)
+	}
+
+	c = <-w.Changes()
+	if c.Type != ChangeDelete || c.Key.String() != "/blocks/a" || c.Seq != 3 {
+		t.Fatal("incorrect change", c)
+	}
+
+	err = hds.Close()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if _, ok := <-w.Changes(); ok {
+		t.Fatal("expected changes to be closed")
+	}
+
+	// watchers created after close are already closed
+	w = hds.Watch(datastore.NewKey("/blocks"))
+	if _, ok := <-w.Changes(); ok {
+		t.Fatal("expected changes to be closed")
+	}
+	w.Close()
+}
+
+func TestWatchBatch(t *testing.T) {
+	bds, err := NewBatching(datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer bds.Close()
+
+	w := bds.Watch(datastore.NewKey("/"))
+	defer w.Close()
+
+	bch, err := bds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = bch.Put(datastore.NewKey("a"), []byte("a"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	err = bch.Delete(datastore.NewKey("b"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	select {
+	case c := <-w.Changes():
+		t.Fatal("unexpected change before commit", c)
+	default:
+	}
+
+	err = bch.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	c := <-w.Changes()
+	if c.Type != ChangePut || c.Key.String() != "/a" || c.Value != nil {
+		t.Fatal("incorrect change", c)
+	}
+
+	c = <-w.Changes()
+	if c.Type != ChangeDelete || c.Key.String() != "/b" || c.Seq != 2 {
+		t.Fatal("incorrect change", c)
+	}
+}
+
+func TestWatchBatchCreatedBeforeWatch(t *testing.T) {
+	bds, err := NewBatching(datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer bds.Close()
+
+	bch, err := bds.Batch()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = bch.Put(datastore.NewKey("a"), []byte("a"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	w := bds.Watch(datastore.NewKey("/"))
+	defer w.Close()
+
+	err = bch.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	select {
+	case c := <-w.Changes():
+		if c.Type != ChangePut || c.Key.String() != "/a" {
+			t.Fatal("incorrect change", c)
+		}
+	default:
+		t.Fatal("expected change on commit")
+	}
+}
+
+func TestWatchTxn(t *testing.T) {
+	wds, err := Wrap(testTxnDatastore{datastore.NewMapDatastore()})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer wds.Close()
+
+	w := wds.(Watchable).Watch(datastore.NewKey("/"))
+	defer w.Close()
+
+	for _, commit := range []bool{false, true} {
+		tx, err := wds.(datastore.TxnDatastore).NewTransaction(false)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		err = tx.Put(datastore.NewKey("a"), []byte("a"))
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if commit {
+			err = tx.Commit()
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+		} else {
+			tx.Discard()
+		}
+	}
+
+	select {
+	case c := <-w.Changes():
+		if c.Type != ChangePut || c.Key.String() != "/a" || c.Seq != 1 {
+			t.Fatal("incorrect change", c)
+		}
+	default:
+		t.Fatal("expected change on commit")
+	}
+	select {
+	case c := <-w.Changes():
+		t.Fatal("unexpected change", c)
+	default:
+	}
+}
+
+func TestWatchSlowSubscriber(t *testing.T) {
+	hds, err := NewDatastore(datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	w := hds.Watch(datastore.NewKey("/"), WithWatchBuffer(1))
+
+	for i := 0; i < 3; i++ {
+		err = hds.Put(datastore.NewKey("test"), []byte("test"))
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+
+	if w.Dropped() != 2 {
+		t.Fatal("expected dropped changes", w.Dropped())
+	}
+
+	w.Close()
+	w.Close()
+}
+
+func TestWatchNegativeBuffer(t *testing.T) {
+	hds, err := NewDatastore(datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer hds.Close()
+
+	w := hds.Watch(datastore.NewKey("/"), WithWatchBuffer(-1))
+	defer w.Close()
+
+	err = hds.Put(datastore.NewKey("test"), []byte("test"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if w.Dropped() != 1 {
+		t.Fatal("expected unbuffered change to be dropped", w.Dropped())
+	}
+}
@@ -0,0 +1,338 @@
+package hook
+
+import (
+	"time"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/internal/hookerr"
+	"github.com/alanshaw/ipfs-hookds/txn"
+	"github.com/ipfs/go-datastore"
+)
+
+//go:generate go run gen_wrap.go
+
+// Wrap wraps a datastore and adds optional before and after hooks into it's
+// methods. Unlike NewDatastore and NewBatching, the returned datastore
+// implements exactly the same set of optional go-datastore interfaces as `ds`
+// (datastore.Batching, datastore.CheckedDatastore, datastore.ScrubbedDatastore,
+// datastore.GCDatastore, datastore.PersistentDatastore, datastore.TTLDatastore
+// and datastore.TxnDatastore), and each of the forwarded methods calls it's own
+// before and after hooks. It returns an error if any of the options fail or
+// are invalid.
+func Wrap(ds datastore.Datastore, options ...Option) (datastore.Datastore, error) {
+	hds, err := NewDatastore(ds, options...)
+	if err != nil {
+		return nil, err
+	}
+	var bds *Batching
+	if b, ok := ds.(datastore.Batching); ok {
+		bds = &Batching{ds: b, hds: hds}
+	}
+	return wrap(hds, bds, capabilitiesOf(ds)), nil
+}
+
+// capability is a bit set of the optional interfaces a datastore implements.
+type capability uint
+
+const (
+	capBatching capability = 1 << iota
+	capChecked
+	capScrubbed
+	capGC
+	capPersistent
+	capTTL
+	capTxn
+)
+
+func capabilitiesOf(ds datastore.Datastore) capability {
+	var caps capability
+	if _, ok := ds.(datastore.Batching); ok {
+		caps |= capBatching
+	}
+	if _, ok := ds.(datastore.CheckedDatastore); ok {
+		caps |= capChecked
+	}
+	if _, ok := ds.(datastore.ScrubbedDatastore); ok {
+		caps |= capScrubbed
+	}
+	if _, ok := ds.(datastore.GCDatastore); ok {
+		caps |= capGC
+	}
+	if _, ok := ds.(datastore.PersistentDatastore); ok {
+		caps |= capPersistent
+	}
+	if _, ok := ds.(datastore.TTLDatastore); ok {
+		caps |= capTTL
+	}
+	if _, ok := ds.(datastore.TxnDatastore); ok {
+		caps |= capTxn
+	}
+	return caps
+}
+
+// checkedDatastore adds hooked datastore.CheckedDatastore methods to a wrapped datastore.
+type checkedDatastore struct {
+	hds *Datastore
+}
+
+// Check checks on-disk data integrity, it calls OnBeforeCheck and OnAfterCheck hooks.
+func (cds checkedDatastore) Check() error {
+	o := cds.hds.options()
+	op := call.Op{Call: call.New("Datastore.Check")}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		var err error
+		for _, f := range o.BeforeCheck {
+			if err = f(c); err != nil {
+				err = hookerr.Wrap(c, "BeforeCheck", f, datastore.Key{}, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			err = cds.hds.ds.(datastore.CheckedDatastore).Check()
+		}
+		for _, f := range o.AfterCheck {
+			prev := err
+			err = f(c, prev)
+			err = hookerr.Wrap(c, "AfterCheck", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
+}
+
+// scrubbedDatastore adds hooked datastore.ScrubbedDatastore methods to a wrapped datastore.
+type scrubbedDatastore struct {
+	hds *Datastore
+}
+
+// Scrub checks data integrity and/or corrects errors, it calls OnBeforeScrub and OnAfterScrub hooks.
+func (sds scrubbedDatastore) Scrub() error {
+	o := sds.hds.options()
+	op := call.Op{Call: call.New("Datastore.Scrub")}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		var err error
+		for _, f := range o.BeforeScrub {
+			if err = f(c); err != nil {
+				err = hookerr.Wrap(c, "BeforeScrub", f, datastore.Key{}, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			err = sds.hds.ds.(datastore.ScrubbedDatastore).Scrub()
+		}
+		for _, f := range o.AfterScrub {
+			prev := err
+			err = f(c, prev)
+			err = hookerr.Wrap(c, "AfterScrub", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
+}
+
+// gcDatastore adds hooked datastore.GCDatastore methods to a wrapped datastore.
+type gcDatastore struct {
+	hds *Datastore
+}
+
+// CollectGarbage frees disk space, it calls OnBeforeCollectGarbage and OnAfterCollectGarbage hooks.
+func (gds gcDatastore) CollectGarbage() error {
+	o := gds.hds.options()
+	op := call.Op{Call: call.New("Datastore.CollectGarbage")}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		var err error
+		for _, f := range o.BeforeCollectGarbage {
+			if err = f(c); err != nil {
+				err = hookerr.Wrap(c, "BeforeCollectGarbage", f, datastore.Key{}, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			err = gds.hds.ds.(datastore.GCDatastore).CollectGarbage()
+		}
+		for _, f := range o.AfterCollectGarbage {
+			prev := err
+			err = f(c, prev)
+			err = hookerr.Wrap(c, "AfterCollectGarbage", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
+}
+
+// persistentDatastore adds hooked datastore.PersistentDatastore methods to a wrapped datastore.
+type persistentDatastore struct {
+	hds *Datastore
+}
+
+// DiskUsage returns the space used by a datastore, in bytes, it calls OnBeforeDiskUsage and OnAfterDiskUsage hooks.
+func (pds persistentDatastore) DiskUsage() (uint64, error) {
+	o := pds.hds.options()
+	op := call.Op{Call: call.New("Datastore.DiskUsage")}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c := op.Call
+		var err error
+		for _, f := range o.BeforeDiskUsage {
+			if err = f(c); err != nil {
+				err = hookerr.Wrap(c, "BeforeDiskUsage", f, datastore.Key{}, nil, err)
+				break
+			}
+		}
+		var usage uint64
+		if err == nil {
+			usage, err = pds.hds.ds.(datastore.PersistentDatastore).DiskUsage()
+		}
+		for _, f := range o.AfterDiskUsage {
+			prev := err
+			usage, err = f(c, usage, prev)
+			err = hookerr.Wrap(c, "AfterDiskUsage", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{DiskUsage: usage, Err: err}
+	})
+	return result.DiskUsage, result.Err
+}
+
+// ttlDatastore adds hooked datastore.TTLDatastore methods to a wrapped datastore.
+type ttlDatastore struct {
+	hds *Datastore
+}
+
+// PutWithTTL stores the object `value` named by `key` that expires after `ttl`, it calls OnBeforePutWithTTL and OnAfterPutWithTTL hooks.
+func (tds ttlDatastore) PutWithTTL(key datastore.Key, value []byte, ttl time.Duration) error {
+	o := tds.hds.options()
+	op := call.Op{Call: call.New("Datastore.PutWithTTL"), Key: key, Value: value, TTL: ttl}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c, key, value, ttl := op.Call, op.Key, op.Value, op.TTL
+		var err error
+		for _, f := range o.BeforePutWithTTL {
+			if key, value, ttl, err = f(c, key, value, ttl); err != nil {
+				err = hookerr.Wrap(c, "BeforePutWithTTL", f, op.Key, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			if err = tds.hds.ds.(datastore.TTLDatastore).PutWithTTL(key, value, ttl); err == nil {
+				tds.hds.publish(Change{Type: ChangePut, Key: key, Value: value})
+			}
+		}
+		for _, f := range o.AfterPutWithTTL {
+			prev := err
+			err = f(c, key, value, ttl, prev)
+			err = hookerr.Wrap(c, "AfterPutWithTTL", f, op.Key, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
+}
+
+// SetTTL sets the time-to-live of the object named by `key`, it calls OnBeforeSetTTL and OnAfterSetTTL hooks.
+func (tds ttlDatastore) SetTTL(key datastore.Key, ttl time.Duration) error {
+	o := tds.hds.options()
+	op := call.Op{Call: call.New("Datastore.SetTTL"), Key: key, TTL: ttl}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c, key, ttl := op.Call, op.Key, op.TTL
+		var err error
+		for _, f := range o.BeforeSetTTL {
+			if key, ttl, err = f(c, key, ttl); err != nil {
+				err = hookerr.Wrap(c, "BeforeSetTTL", f, op.Key, nil, err)
+				break
+			}
+		}
+		if err == nil {
+			err = tds.hds.ds.(datastore.TTLDatastore).SetTTL(key, ttl)
+		}
+		for _, f := range o.AfterSetTTL {
+			prev := err
+			err = f(c, key, ttl, prev)
+			err = hookerr.Wrap(c, "AfterSetTTL", f, op.Key, prev, err)
+		}
+		return call.Result{Err: err}
+	})
+	return result.Err
+}
+
+// GetExpiration returns the expiration time of the object named by `key`, it calls OnBeforeGetExpiration and OnAfterGetExpiration hooks.
+func (tds ttlDatastore) GetExpiration(key datastore.Key) (time.Time, error) {
+	o := tds.hds.options()
+	op := call.Op{Call: call.New("Datastore.GetExpiration"), Key: key}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c, key := op.Call, op.Key
+		var err error
+		for _, f := range o.BeforeGetExpiration {
+			if key, err = f(c, key); err != nil {
+				err = hookerr.Wrap(c, "BeforeGetExpiration", f, op.Key, nil, err)
+				break
+			}
+		}
+		var expiration time.Time
+		if err == nil {
+			expiration, err = tds.hds.ds.(datastore.TTLDatastore).GetExpiration(key)
+		}
+		for _, f := range o.AfterGetExpiration {
+			prev := err
+			expiration, err = f(c, key, expiration, prev)
+			err = hookerr.Wrap(c, "AfterGetExpiration", f, op.Key, prev, err)
+		}
+		return call.Result{Expiration: expiration, Err: err}
+	})
+	return result.Expiration, result.Err
+}
+
+// txnDatastore adds hooked datastore.TxnDatastore methods to a wrapped datastore.
+type txnDatastore struct {
+	hds *Datastore
+}
+
+// NewTransaction creates a transaction, it calls OnBeforeNewTransaction and OnAfterNewTransaction hooks.
+func (tds txnDatastore) NewTransaction(readOnly bool) (datastore.Txn, error) {
+	o := tds.hds.options()
+	op := call.Op{Call: call.New("Datastore.NewTransaction"), ReadOnly: readOnly}
+	result := call.Invoke(o.Interceptors, op, func(op call.Op) call.Result {
+		c, readOnly := op.Call, op.ReadOnly
+		var err error
+		for _, f := range o.BeforeNewTransaction {
+			if readOnly, err = f(c, readOnly); err != nil {
+				err = hookerr.Wrap(c, "BeforeNewTransaction", f, datastore.Key{}, nil, err)
+				break
+			}
+		}
+		var tx datastore.Txn
+		if err == nil {
+			tx, err = tds.hds.ds.(datastore.TxnDatastore).NewTransaction(readOnly)
+		}
+		if err == nil {
+			tx = newWatchTxn(tds.hds, tx)
+		}
+		if err == nil && (len(o.Interceptors) > 0 || len(o.ResultsOptions) > 0) {
+			tx, err = hookTxn(o, tx)
+		}
+		for _, f := range o.AfterNewTransaction {
+			prev := err
+			tx, err = f(c, readOnly, tx, prev)
+			err = hookerr.Wrap(c, "AfterNewTransaction", f, datastore.Key{}, prev, err)
+		}
+		return call.Result{Txn: tx, Err: err}
+	})
+	return result.Txn, result.Err
+}
+
+// hookTxn wraps a transaction so that the interceptors in `o` are called for
+// it's operations and the results options in `o` are applied to the results of
+// it's queries.
+func hookTxn(o *Options, tx datastore.Txn) (datastore.Txn, error) {
+	var options []txn.Option
+	for _, i := range o.Interceptors {
+		options = append(options, txn.WithInterceptor(i))
+	}
+	if len(o.ResultsOptions) > 0 {
+		options = append(options, txn.WithQueryResults(resultsOptions(o)...))
+	}
+	htx, err := txn.NewTxn(tx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return htx, nil
+}
@@ -0,0 +1,904 @@
+// Code generated by gen_wrap.go; DO NOT EDIT.
+
+package hook
+
+import "github.com/ipfs/go-datastore"
+
+// wrap returns a datastore that implements exactly the interfaces in `caps`.
+func wrap(hds *Datastore, bds *Batching, caps capability) datastore.Datastore {
+	switch caps {
+	case 0:
+		return hds
+	case capChecked:
+		return struct {
+			*Datastore
+			checkedDatastore
+		}{hds, checkedDatastore{hds}}
+	case capScrubbed:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+		}{hds, scrubbedDatastore{hds}}
+	case capChecked | capScrubbed:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}}
+	case capGC:
+		return struct {
+			*Datastore
+			gcDatastore
+		}{hds, gcDatastore{hds}}
+	case capChecked | capGC:
+		return struct {
+			*Datastore
+			checkedDatastore
+			gcDatastore
+		}{hds, checkedDatastore{hds}, gcDatastore{hds}}
+	case capScrubbed | capGC:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			gcDatastore
+		}{hds, scrubbedDatastore{hds}, gcDatastore{hds}}
+	case capChecked | capScrubbed | capGC:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}}
+	case capPersistent:
+		return struct {
+			*Datastore
+			persistentDatastore
+		}{hds, persistentDatastore{hds}}
+	case capChecked | capPersistent:
+		return struct {
+			*Datastore
+			checkedDatastore
+			persistentDatastore
+		}{hds, checkedDatastore{hds}, persistentDatastore{hds}}
+	case capScrubbed | capPersistent:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			persistentDatastore
+		}{hds, scrubbedDatastore{hds}, persistentDatastore{hds}}
+	case capChecked | capScrubbed | capPersistent:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			persistentDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, persistentDatastore{hds}}
+	case capGC | capPersistent:
+		return struct {
+			*Datastore
+			gcDatastore
+			persistentDatastore
+		}{hds, gcDatastore{hds}, persistentDatastore{hds}}
+	case capChecked | capGC | capPersistent:
+		return struct {
+			*Datastore
+			checkedDatastore
+			gcDatastore
+			persistentDatastore
+		}{hds, checkedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}}
+	case capScrubbed | capGC | capPersistent:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+		}{hds, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}}
+	case capChecked | capScrubbed | capGC | capPersistent:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}}
+	case capTTL:
+		return struct {
+			*Datastore
+			ttlDatastore
+		}{hds, ttlDatastore{hds}}
+	case capChecked | capTTL:
+		return struct {
+			*Datastore
+			checkedDatastore
+			ttlDatastore
+		}{hds, checkedDatastore{hds}, ttlDatastore{hds}}
+	case capScrubbed | capTTL:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			ttlDatastore
+		}{hds, scrubbedDatastore{hds}, ttlDatastore{hds}}
+	case capChecked | capScrubbed | capTTL:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			ttlDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, ttlDatastore{hds}}
+	case capGC | capTTL:
+		return struct {
+			*Datastore
+			gcDatastore
+			ttlDatastore
+		}{hds, gcDatastore{hds}, ttlDatastore{hds}}
+	case capChecked | capGC | capTTL:
+		return struct {
+			*Datastore
+			checkedDatastore
+			gcDatastore
+			ttlDatastore
+		}{hds, checkedDatastore{hds}, gcDatastore{hds}, ttlDatastore{hds}}
+	case capScrubbed | capGC | capTTL:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			gcDatastore
+			ttlDatastore
+		}{hds, scrubbedDatastore{hds}, gcDatastore{hds}, ttlDatastore{hds}}
+	case capChecked | capScrubbed | capGC | capTTL:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			ttlDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, ttlDatastore{hds}}
+	case capPersistent | capTTL:
+		return struct {
+			*Datastore
+			persistentDatastore
+			ttlDatastore
+		}{hds, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capChecked | capPersistent | capTTL:
+		return struct {
+			*Datastore
+			checkedDatastore
+			persistentDatastore
+			ttlDatastore
+		}{hds, checkedDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capScrubbed | capPersistent | capTTL:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			persistentDatastore
+			ttlDatastore
+		}{hds, scrubbedDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capChecked | capScrubbed | capPersistent | capTTL:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			persistentDatastore
+			ttlDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capGC | capPersistent | capTTL:
+		return struct {
+			*Datastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+		}{hds, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capChecked | capGC | capPersistent | capTTL:
+		return struct {
+			*Datastore
+			checkedDatastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+		}{hds, checkedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capScrubbed | capGC | capPersistent | capTTL:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+		}{hds, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capChecked | capScrubbed | capGC | capPersistent | capTTL:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capTxn:
+		return struct {
+			*Datastore
+			txnDatastore
+		}{hds, txnDatastore{hds}}
+	case capChecked | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, txnDatastore{hds}}
+	case capScrubbed | capTxn:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			txnDatastore
+		}{hds, scrubbedDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capScrubbed | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, txnDatastore{hds}}
+	case capGC | capTxn:
+		return struct {
+			*Datastore
+			gcDatastore
+			txnDatastore
+		}{hds, gcDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capGC | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			gcDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, gcDatastore{hds}, txnDatastore{hds}}
+	case capScrubbed | capGC | capTxn:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			gcDatastore
+			txnDatastore
+		}{hds, scrubbedDatastore{hds}, gcDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capScrubbed | capGC | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, txnDatastore{hds}}
+	case capPersistent | capTxn:
+		return struct {
+			*Datastore
+			persistentDatastore
+			txnDatastore
+		}{hds, persistentDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capPersistent | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			persistentDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capScrubbed | capPersistent | capTxn:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			persistentDatastore
+			txnDatastore
+		}{hds, scrubbedDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capScrubbed | capPersistent | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			persistentDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capGC | capPersistent | capTxn:
+		return struct {
+			*Datastore
+			gcDatastore
+			persistentDatastore
+			txnDatastore
+		}{hds, gcDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capGC | capPersistent | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			gcDatastore
+			persistentDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capScrubbed | capGC | capPersistent | capTxn:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+			txnDatastore
+		}{hds, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capScrubbed | capGC | capPersistent | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capTTL | capTxn:
+		return struct {
+			*Datastore
+			ttlDatastore
+			txnDatastore
+		}{hds, ttlDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capTTL | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capScrubbed | capTTL | capTxn:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, scrubbedDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capScrubbed | capTTL | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capGC | capTTL | capTxn:
+		return struct {
+			*Datastore
+			gcDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, gcDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capGC | capTTL | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			gcDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, gcDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capScrubbed | capGC | capTTL | capTxn:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			gcDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, scrubbedDatastore{hds}, gcDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capScrubbed | capGC | capTTL | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capPersistent | capTTL | capTxn:
+		return struct {
+			*Datastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capPersistent | capTTL | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capScrubbed | capPersistent | capTTL | capTxn:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, scrubbedDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capScrubbed | capPersistent | capTTL | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capGC | capPersistent | capTTL | capTxn:
+		return struct {
+			*Datastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capGC | capPersistent | capTTL | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capScrubbed | capGC | capPersistent | capTTL | capTxn:
+		return struct {
+			*Datastore
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capChecked | capScrubbed | capGC | capPersistent | capTTL | capTxn:
+		return struct {
+			*Datastore
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{hds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching:
+		return bds
+	case capBatching | capChecked:
+		return struct {
+			*Batching
+			checkedDatastore
+		}{bds, checkedDatastore{hds}}
+	case capBatching | capScrubbed:
+		return struct {
+			*Batching
+			scrubbedDatastore
+		}{bds, scrubbedDatastore{hds}}
+	case capBatching | capChecked | capScrubbed:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}}
+	case capBatching | capGC:
+		return struct {
+			*Batching
+			gcDatastore
+		}{bds, gcDatastore{hds}}
+	case capBatching | capChecked | capGC:
+		return struct {
+			*Batching
+			checkedDatastore
+			gcDatastore
+		}{bds, checkedDatastore{hds}, gcDatastore{hds}}
+	case capBatching | capScrubbed | capGC:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			gcDatastore
+		}{bds, scrubbedDatastore{hds}, gcDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capGC:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}}
+	case capBatching | capPersistent:
+		return struct {
+			*Batching
+			persistentDatastore
+		}{bds, persistentDatastore{hds}}
+	case capBatching | capChecked | capPersistent:
+		return struct {
+			*Batching
+			checkedDatastore
+			persistentDatastore
+		}{bds, checkedDatastore{hds}, persistentDatastore{hds}}
+	case capBatching | capScrubbed | capPersistent:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			persistentDatastore
+		}{bds, scrubbedDatastore{hds}, persistentDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capPersistent:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			persistentDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, persistentDatastore{hds}}
+	case capBatching | capGC | capPersistent:
+		return struct {
+			*Batching
+			gcDatastore
+			persistentDatastore
+		}{bds, gcDatastore{hds}, persistentDatastore{hds}}
+	case capBatching | capChecked | capGC | capPersistent:
+		return struct {
+			*Batching
+			checkedDatastore
+			gcDatastore
+			persistentDatastore
+		}{bds, checkedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}}
+	case capBatching | capScrubbed | capGC | capPersistent:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+		}{bds, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capGC | capPersistent:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}}
+	case capBatching | capTTL:
+		return struct {
+			*Batching
+			ttlDatastore
+		}{bds, ttlDatastore{hds}}
+	case capBatching | capChecked | capTTL:
+		return struct {
+			*Batching
+			checkedDatastore
+			ttlDatastore
+		}{bds, checkedDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capScrubbed | capTTL:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			ttlDatastore
+		}{bds, scrubbedDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capTTL:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			ttlDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capGC | capTTL:
+		return struct {
+			*Batching
+			gcDatastore
+			ttlDatastore
+		}{bds, gcDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capChecked | capGC | capTTL:
+		return struct {
+			*Batching
+			checkedDatastore
+			gcDatastore
+			ttlDatastore
+		}{bds, checkedDatastore{hds}, gcDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capScrubbed | capGC | capTTL:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			gcDatastore
+			ttlDatastore
+		}{bds, scrubbedDatastore{hds}, gcDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capGC | capTTL:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			ttlDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capPersistent | capTTL:
+		return struct {
+			*Batching
+			persistentDatastore
+			ttlDatastore
+		}{bds, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capChecked | capPersistent | capTTL:
+		return struct {
+			*Batching
+			checkedDatastore
+			persistentDatastore
+			ttlDatastore
+		}{bds, checkedDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capScrubbed | capPersistent | capTTL:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			persistentDatastore
+			ttlDatastore
+		}{bds, scrubbedDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capPersistent | capTTL:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			persistentDatastore
+			ttlDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capGC | capPersistent | capTTL:
+		return struct {
+			*Batching
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+		}{bds, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capChecked | capGC | capPersistent | capTTL:
+		return struct {
+			*Batching
+			checkedDatastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+		}{bds, checkedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capScrubbed | capGC | capPersistent | capTTL:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+		}{bds, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capGC | capPersistent | capTTL:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}}
+	case capBatching | capTxn:
+		return struct {
+			*Batching
+			txnDatastore
+		}{bds, txnDatastore{hds}}
+	case capBatching | capChecked | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capScrubbed | capTxn:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			txnDatastore
+		}{bds, scrubbedDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capGC | capTxn:
+		return struct {
+			*Batching
+			gcDatastore
+			txnDatastore
+		}{bds, gcDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capGC | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			gcDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, gcDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capScrubbed | capGC | capTxn:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			gcDatastore
+			txnDatastore
+		}{bds, scrubbedDatastore{hds}, gcDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capGC | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capPersistent | capTxn:
+		return struct {
+			*Batching
+			persistentDatastore
+			txnDatastore
+		}{bds, persistentDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capPersistent | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			persistentDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capScrubbed | capPersistent | capTxn:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			persistentDatastore
+			txnDatastore
+		}{bds, scrubbedDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capPersistent | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			persistentDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capGC | capPersistent | capTxn:
+		return struct {
+			*Batching
+			gcDatastore
+			persistentDatastore
+			txnDatastore
+		}{bds, gcDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capGC | capPersistent | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			gcDatastore
+			persistentDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capScrubbed | capGC | capPersistent | capTxn:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+			txnDatastore
+		}{bds, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capGC | capPersistent | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capTTL | capTxn:
+		return struct {
+			*Batching
+			ttlDatastore
+			txnDatastore
+		}{bds, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capTTL | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capScrubbed | capTTL | capTxn:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, scrubbedDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capTTL | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capGC | capTTL | capTxn:
+		return struct {
+			*Batching
+			gcDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, gcDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capGC | capTTL | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			gcDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, gcDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capScrubbed | capGC | capTTL | capTxn:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			gcDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, scrubbedDatastore{hds}, gcDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capGC | capTTL | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capPersistent | capTTL | capTxn:
+		return struct {
+			*Batching
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capPersistent | capTTL | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capScrubbed | capPersistent | capTTL | capTxn:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, scrubbedDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capPersistent | capTTL | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capGC | capPersistent | capTTL | capTxn:
+		return struct {
+			*Batching
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capGC | capPersistent | capTTL | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capScrubbed | capGC | capPersistent | capTTL | capTxn:
+		return struct {
+			*Batching
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	case capBatching | capChecked | capScrubbed | capGC | capPersistent | capTTL | capTxn:
+		return struct {
+			*Batching
+			checkedDatastore
+			scrubbedDatastore
+			gcDatastore
+			persistentDatastore
+			ttlDatastore
+			txnDatastore
+		}{bds, checkedDatastore{hds}, scrubbedDatastore{hds}, gcDatastore{hds}, persistentDatastore{hds}, ttlDatastore{hds}, txnDatastore{hds}}
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,238 @@
+package hook
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alanshaw/ipfs-hookds/call"
+	"github.com/alanshaw/ipfs-hookds/query/results"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// capDatastore is a batching datastore that also implements some optional
+// datastore interfaces.
+type capDatastore struct {
+	*datastore.MapDatastore
+}
+
+func (cds capDatastore) Check() error {
+	return nil
+}
+
+func (cds capDatastore) CollectGarbage() error {
+	return nil
+}
+
+func (cds capDatastore) DiskUsage() (uint64, error) {
+	return 138, nil
+}
+
+func TestWrapCapabilities(t *testing.T) {
+	ds := capDatastore{datastore.NewMapDatastore()}
+	wds, err := Wrap(ds)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer wds.Close()
+
+	if _, ok := wds.(datastore.Batching); !ok {
+		t.Fatal("expected datastore.Batching")
+	}
+	if _, ok := wds.(datastore.CheckedDatastore); !ok {
+		t.Fatal("expected datastore.CheckedDatastore")
+	}
+	if _, ok := wds.(datastore.GCDatastore); !ok {
+		t.Fatal("expected datastore.GCDatastore")
+	}
+	if _, ok := wds.(datastore.PersistentDatastore); !ok {
+		t.Fatal("expected datastore.PersistentDatastore")
+	}
+	if _, ok := wds.(datastore.ScrubbedDatastore); ok {
+		t.Fatal("unexpected datastore.ScrubbedDatastore")
+	}
+	if _, ok := wds.(datastore.TTLDatastore); ok {
+		t.Fatal("unexpected datastore.TTLDatastore")
+	}
+	if _, ok := wds.(Watchable); !ok {
+		t.Fatal("expected Watchable")
+	}
+}
+
+func TestWrapNoCapabilities(t *testing.T) {
+	ds, err := NewDatastore(datastore.NewMapDatastore())
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	wds, err := Wrap(ds)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer wds.Close()
+
+	if _, ok := wds.(datastore.Batching); ok {
+		t.Fatal("unexpected datastore.Batching")
+	}
+	if _, ok := wds.(datastore.PersistentDatastore); ok {
+		t.Fatal("unexpected datastore.PersistentDatastore")
+	}
+}
+
+func TestWrapHookDiskUsage(t *testing.T) {
+	beforeHookCalled := false
+	afterHookCalled := false
+
+	onBeforeDiskUsage := func(c *call.Call) error {
+		beforeHookCalled = true
+		return nil
+	}
+
+	onAfterDiskUsage := func(c *call.Call, usage uint64, err error) (uint64, error) {
+		if usage != 138 {
+			t.Fatal("incorrect disk usage")
+		}
+		afterHookCalled = true
+		return usage, err
+	}
+
+	ds := capDatastore{datastore.NewMapDatastore()}
+	wds, err := Wrap(ds, WithBeforeDiskUsage(onBeforeDiskUsage), WithAfterDiskUsage(onAfterDiskUsage))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer wds.Close()
+
+	usage, err := datastore.DiskUsage(wds)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if usage != 138 {
+		t.Fatal("incorrect disk usage")
+	}
+
+	if !beforeHookCalled {
+		t.Fatal("before hook not called")
+	}
+
+	if !afterHookCalled {
+		t.Fatal("after hook not called")
+	}
+}
+
+// testTxnDatastore is a datastore that supports transactions.
+type testTxnDatastore struct {
+	*datastore.MapDatastore
+}
+
+// testTxn is a transaction that reads from a datastore and writes to a batch.
+type testTxn struct {
+	datastore.Batch
+	datastore.Read
+}
+
+func (tx testTxn) Discard() {}
+
+func (tds testTxnDatastore) NewTransaction(readOnly bool) (datastore.Txn, error) {
+	bch, err := tds.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return testTxn{Batch: bch, Read: tds.MapDatastore}, nil
+}
+
+func TestWrapHookNewTransaction(t *testing.T) {
+	beforeHookCalled := false
+	afterHookCalled := false
+
+	onBeforeNewTransaction := func(c *call.Call, readOnly bool) (bool, error) {
+		if readOnly {
+			t.Fatal("incorrect read only")
+		}
+		beforeHookCalled = true
+		return readOnly, nil
+	}
+
+	onAfterNewTransaction := func(c *call.Call, readOnly bool, txn datastore.Txn, err error) (datastore.Txn, error) {
+		afterHookCalled = true
+		return txn, err
+	}
+
+	ds := testTxnDatastore{datastore.NewMapDatastore()}
+	wds, err := Wrap(ds, WithBeforeNewTransaction(onBeforeNewTransaction), WithAfterNewTransaction(onAfterNewTransaction))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer wds.Close()
+
+	tds, ok := wds.(datastore.TxnDatastore)
+	if !ok {
+		t.Fatal("expected datastore.TxnDatastore")
+	}
+
+	txn, err := tds.NewTransaction(false)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = txn.Put(datastore.NewKey("test"), []byte("test"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	err = txn.Commit()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	if !beforeHookCalled {
+		t.Fatal("before hook not called")
+	}
+
+	if !afterHookCalled {
+		t.Fatal("after hook not called")
+	}
+}
+
+func TestWrapTxnQueryResults(t *testing.T) {
+	var ops []string
+	interceptor := func(op call.Op, next call.Handler) call.Result {
+		ops = append(ops, op.Call.Op())
+		return next(op)
+	}
+
+	ds := testTxnDatastore{datastore.NewMapDatastore()}
+	for _, k := range []string{"/a", "/b"} {
+		if err := ds.Put(datastore.NewKey(k), []byte(k)); err != nil {
+			t.Fatal("unexpected error", err)
+		}
+	}
+
+	wds, err := Wrap(ds, WithInterceptor(interceptor), WithQueryResults(results.WithMaxEntries(1)))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer wds.Close()
+
+	tx, err := wds.(datastore.TxnDatastore).NewTransaction(true)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	defer tx.Discard()
+
+	res, err := tx.Query(query.Query{})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	_, err = res.Rest()
+	var lerr *results.LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != results.LimitEntries {
+		t.Fatal("expected max entries error", err)
+	}
+
+	if len(ops) != 3 || ops[1] != "Txn.Query" || ops[2] != "Results.Rest" {
+		t.Fatal("incorrect intercepted operations", ops)
+	}
+}